@@ -0,0 +1,170 @@
+// Code generated by struct-to-pflags; DO NOT EDIT.
+
+package example
+
+import (
+	"time"
+
+	"github.com/kr3v/struct-to-pflags/example/other"
+	"github.com/kr3v/struct-to-pflags/example/types"
+	"github.com/spf13/pflag"
+)
+
+const (
+
+	// retryOptions flags
+	flagRetryAttemptsDefaultValue = "retry-attempts-default-value"
+
+	// ServerOptions flags
+	flagServerAddr = "server-addr"
+
+	// ServerOptions.TLSOptions flags
+	flagServerTLSEnabled  = "server-tls-enabled"
+	flagServerTLSCertFile = "server-tls-cert-file"
+
+	// ClientOptions flags
+	flagClientTimeout = "client-timeout"
+
+	// ClientOptions.TLSOptions flags
+	flagClientTLSEnabled = "client-tls-enabled"
+	flagClientTLSCaFile  = "client-tls-ca-file"
+
+	// StoreOptions flags
+	flagStoreName = "store-name"
+
+	// StoreOptions.DB flags
+	flagStoreDbHost = "store-db-host"
+	flagStoreDbPort = "store-db-port"
+
+	// routeNode flags
+	flagPath = "path"
+)
+
+func withProxyConfigFlags(flags *pflag.FlagSet) {
+
+	// retryOptions flags
+	flags.Int(flagRetryAttemptsDefaultValue, defaultRetryOptions.attempts, "attempts before giving up")
+
+	// ServerOptions flags
+	flags.String(flagServerAddr, types.DefaultServerOptions.Addr, "address to listen on")
+
+	// ServerOptions.TLSOptions flags
+	flags.Bool(flagServerTLSEnabled, types.DefaultServerOptions.TLSOptions.Enabled, "serve TLS")
+	flags.String(flagServerTLSCertFile, "", "path to the certificate file")
+
+	// ClientOptions flags
+	flags.Duration(flagClientTimeout, 0, "request timeout")
+
+	// ClientOptions.TLSOptions flags
+	flags.Bool(flagClientTLSEnabled, defaultProxyConfig.ClientOptions.TLSOptions.Enabled, "verify the server certificate")
+	flags.String(flagClientTLSCaFile, "", "path to the CA bundle")
+
+	// StoreOptions flags
+	flags.String(flagStoreName, "", "store name")
+
+	// StoreOptions.DB flags
+	flags.String(flagStoreDbHost, defaultProxyConfig.StoreOptions.DB.Host, "database host")
+	flags.Int(flagStoreDbPort, defaultProxyConfig.StoreOptions.DB.Port, "database port")
+
+	// routeNode flags
+	flags.String(flagPath, "", "route path")
+}
+
+func loadProxyConfig(flags *pflag.FlagSet, routeNodeRouteNode *routeNode) (*proxyConfig, error) {
+	// retryOptions
+	retryOptionsAttempts, err := flags.GetInt(flagRetryAttemptsDefaultValue)
+	if err != nil {
+		return nil, err
+	}
+
+	// ServerOptions
+	serverOptionsAddr, err := flags.GetString(flagServerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// ServerOptions.TLSOptions
+	serverOptionsTLSOptionsEnabled, err := flags.GetBool(flagServerTLSEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	serverOptionsTLSOptionsCertFile, err := flags.GetString(flagServerTLSCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// ClientOptions
+	clientOptionsTimeout, err := flags.GetDuration(flagClientTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// ClientOptions.TLSOptions
+	clientOptionsTLSOptionsEnabled, err := flags.GetBool(flagClientTLSEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOptionsTLSOptionsCAFile, err := flags.GetString(flagClientTLSCaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// StoreOptions
+	storeOptionsName, err := flags.GetString(flagStoreName)
+	if err != nil {
+		return nil, err
+	}
+
+	// StoreOptions.DB
+	storeOptionsDBHost, err := flags.GetString(flagStoreDbHost)
+	if err != nil {
+		return nil, err
+	}
+
+	storeOptionsDBPort, err := flags.GetInt(flagStoreDbPort)
+	if err != nil {
+		return nil, err
+	}
+
+	// routeNode
+	routeNodePath, err := flags.GetString(flagPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyConfig{
+		retryOptions: retryOptions{
+			attempts: retryOptionsAttempts,
+		},
+		ServerOptions: types.ServerOptions{
+			Addr: serverOptionsAddr,
+			TLSOptions: types.TLSOptions{
+				Enabled:  serverOptionsTLSOptionsEnabled,
+				CertFile: serverOptionsTLSOptionsCertFile,
+			},
+		},
+		ClientOptions: &other.ClientOptions{
+			Timeout: clientOptionsTimeout,
+			TLSOptions: other.TLSOptions{
+				Enabled: clientOptionsTLSOptionsEnabled,
+				CAFile:  clientOptionsTLSOptionsCAFile,
+			},
+		},
+		StoreOptions: types.StoreOptions{
+			Name: storeOptionsName,
+			DB: types.DBConfig{
+				Host: storeOptionsDBHost,
+				Port: storeOptionsDBPort,
+			},
+		},
+		routeNode: routeNode{
+			path:      routeNodePath,
+			routeNode: routeNodeRouteNode,
+		},
+	}, nil
+}
+
+// Ensure unused import is used
+var _ = time.Second
@@ -0,0 +1,36 @@
+//go:generate struct-to-pflags -file=embedded.go -struct=proxyConfig -output=embedded.gen.go
+
+package example
+
+import (
+	"github.com/kr3v/struct-to-pflags/example/other"
+	"github.com/kr3v/struct-to-pflags/example/types"
+)
+
+// retryOptions configures retries of failed requests
+type retryOptions struct {
+	// attempts before giving up
+	attempts int
+}
+
+var defaultRetryOptions = retryOptions{attempts: 3}
+
+// routeNode is a node of the routing tree, its parent is passed to loadProxyConfig
+type routeNode struct {
+	*routeNode `pflags:"-"`
+	// route path
+	path string
+}
+
+type proxyConfig struct {
+	retryOptions
+	types.ServerOptions  `pflags:"prefix=server"`
+	*other.ClientOptions `pflags:"prefix=client"`
+	types.StoreOptions   `pflags:"prefix=store"`
+	routeNode            `pflags:"inline"`
+}
+
+var defaultProxyConfig = proxyConfig{
+	ClientOptions: &other.ClientOptions{TLSOptions: other.TLSOptions{Enabled: true}},
+	StoreOptions:  types.StoreOptions{DB: types.DBConfig{Host: "localhost", Port: 5432}},
+}
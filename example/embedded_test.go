@@ -0,0 +1,34 @@
+package example
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Embedded structs default to the proxy defaults, else to the default variable of their type, and the skipped
+// parent route is passed to loadProxyConfig
+func Example_loadProxyConfig() {
+	flags := pflag.NewFlagSet("example", pflag.ContinueOnError)
+	withProxyConfigFlags(flags)
+	if err := flags.Parse([]string{"--server-tls-cert-file=server.pem", "--client-timeout=5s", "--store-db-port=6432", "--path=/api"}); err != nil {
+		panic(err)
+	}
+
+	cfg, err := loadProxyConfig(flags, &routeNode{path: "/"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.attempts)
+	fmt.Println(cfg.ServerOptions.Addr, cfg.ServerOptions.TLSOptions.Enabled, cfg.ServerOptions.TLSOptions.CertFile)
+	fmt.Println(cfg.ClientOptions.Timeout, cfg.ClientOptions.TLSOptions.Enabled)
+	fmt.Println(cfg.StoreOptions.DB.Host, cfg.StoreOptions.DB.Port)
+	fmt.Println(cfg.routeNode.path, cfg.routeNode.routeNode.path)
+
+	// Output:
+	// 3
+	// :8443 true server.pem
+	// 5s true
+	// localhost 6432
+	// /api /
+}
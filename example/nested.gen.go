@@ -0,0 +1,152 @@
+// Code generated by struct-to-pflags; DO NOT EDIT.
+
+package example
+
+import (
+	"strconv"
+
+	"github.com/kr3v/struct-to-pflags/example/types"
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagName      = "name"
+	flagVerbosity = "verbosity"
+
+	// db flags
+	flagDbHost = "db-host"
+	flagDbPort = "db-port"
+
+	// db.tls flags
+	flagDbTLSEnabled  = "db-tls-enabled"
+	flagDbTLSCertFile = "db-tls-cert-file"
+
+	// replica flags
+	flagReplicaHost = "replica-host"
+	flagReplicaPort = "replica-port"
+
+	// replica.tls flags
+	flagReplicaTLSEnabled  = "replica-tls-enabled"
+	flagReplicaTLSCertFile = "replica-tls-cert-file"
+
+	// upstream flags
+	flagUpstreamHost = "upstream-host"
+	flagUpstreamPort = "upstream-port"
+)
+
+func withAppConfigFlags(flags *pflag.FlagSet) {
+	defaults := newAppConfig()
+
+	flags.String(flagName, defaults.name, "application name")
+	flags.CountP(flagVerbosity, "v", "log verbosity")
+	verbosityFlag := flags.Lookup(flagVerbosity)
+	_ = verbosityFlag.Value.Set(strconv.Itoa(defaults.verbosity))
+	verbosityFlag.DefValue = verbosityFlag.Value.String()
+
+	// db flags
+	flags.String(flagDbHost, defaults.db.host, "database host")
+	flags.Int(flagDbPort, defaults.db.port, "database port")
+
+	// db.tls flags
+	flags.Bool(flagDbTLSEnabled, defaults.db.tls.enabled, "serve HTTPS")
+	flags.String(flagDbTLSCertFile, defaults.db.tls.certFile, "path to the certificate file")
+
+	// replica flags
+	flags.String(flagReplicaHost, "", "database host")
+	flags.Int(flagReplicaPort, 0, "database port")
+
+	// replica.tls flags
+	flags.Bool(flagReplicaTLSEnabled, false, "serve HTTPS")
+	flags.String(flagReplicaTLSCertFile, "", "path to the certificate file")
+
+	// upstream flags
+	flags.String(flagUpstreamHost, defaults.upstream.Host, "host name")
+	flags.Int(flagUpstreamPort, defaults.upstream.Port, "port number")
+}
+
+func loadAppConfig(flags *pflag.FlagSet) (*appConfig, error) {
+	name, err := flags.GetString(flagName)
+	if err != nil {
+		return nil, err
+	}
+
+	verbosity, err := flags.GetCount(flagVerbosity)
+	if err != nil {
+		return nil, err
+	}
+
+	dbHost, err := flags.GetString(flagDbHost)
+	if err != nil {
+		return nil, err
+	}
+
+	dbPort, err := flags.GetInt(flagDbPort)
+	if err != nil {
+		return nil, err
+	}
+
+	dbTlsEnabled, err := flags.GetBool(flagDbTLSEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	dbTlsCertFile, err := flags.GetString(flagDbTLSCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaHost, err := flags.GetString(flagReplicaHost)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaPort, err := flags.GetInt(flagReplicaPort)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaTlsEnabled, err := flags.GetBool(flagReplicaTLSEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaTlsCertFile, err := flags.GetString(flagReplicaTLSCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamHost, err := flags.GetString(flagUpstreamHost)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamPort, err := flags.GetInt(flagUpstreamPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appConfig{
+		name:      name,
+		verbosity: verbosity,
+		db: dbConfig{
+			host: dbHost,
+			port: dbPort,
+			tls: tlsOptions{
+				enabled:  dbTlsEnabled,
+				certFile: dbTlsCertFile,
+			},
+		},
+		replica: &dbConfig{
+			host: replicaHost,
+			port: replicaPort,
+			tls: tlsOptions{
+				enabled:  replicaTlsEnabled,
+				certFile: replicaTlsCertFile,
+			},
+		},
+		upstream: types.Endpoint{
+			Host: upstreamHost,
+			Port: upstreamPort,
+		},
+	}, nil
+}
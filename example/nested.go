@@ -0,0 +1,37 @@
+//go:generate struct-to-pflags -file=nested.go -struct=appConfig -defaults=newAppConfig -output=nested.gen.go
+
+package example
+
+import "github.com/kr3v/struct-to-pflags/example/types"
+
+// dbConfig configures the database connection
+type dbConfig struct {
+	// database host
+	host string
+	// database port
+	port int
+	// TLS to the database
+	tls tlsOptions
+}
+
+type appConfig struct {
+	// application name
+	name string
+	// log verbosity
+	verbosity int `pflags:"count"`
+	// primary database
+	db dbConfig
+	// read replica
+	replica *dbConfig
+	// upstream service
+	upstream types.Endpoint
+}
+
+func newAppConfig() appConfig {
+	return appConfig{
+		name:      "app",
+		verbosity: 1,
+		db:        dbConfig{host: "localhost", port: 5432},
+		upstream:  types.Endpoint{Port: 443},
+	}
+}
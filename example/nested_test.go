@@ -0,0 +1,31 @@
+package example
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Nested structs get prefixed flags, the count flag starts from its default and the pointer struct is allocated
+func Example_loadAppConfig() {
+	flags := pflag.NewFlagSet("example", pflag.ContinueOnError)
+	withAppConfigFlags(flags)
+	if err := flags.Parse([]string{"-vv", "--db-tls-enabled", "--replica-host=replica", "--upstream-host=api.example.com"}); err != nil {
+		panic(err)
+	}
+
+	cfg, err := loadAppConfig(flags)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.name, cfg.verbosity)
+	fmt.Println(cfg.db.host, cfg.db.port, cfg.db.tls.enabled)
+	fmt.Println(cfg.replica.host, cfg.replica.port)
+	fmt.Println(cfg.upstream.Host, cfg.upstream.Port)
+
+	// Output:
+	// app 3
+	// localhost 5432 true
+	// replica 0
+	// api.example.com 443
+}
@@ -0,0 +1,72 @@
+// Code generated by struct-to-pflags; DO NOT EDIT.
+
+package example
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagBindIP      = "bind-ip"
+	flagAllowedNet  = "allowed-net"
+	flagClientMask  = "client-mask"
+	flagDNSServer   = "dns-server"
+	flagFallbackDNS = "fallback-dns"
+)
+
+func withNetworkConfigFlags(flags *pflag.FlagSet) {
+	flags.IP(flagBindIP, nil, "address to bind the server")
+	flags.IPNet(flagAllowedNet, net.IPNet{}, "network allowed to connect")
+	flags.IPMask(flagClientMask, net.IPv4Mask(0, 0, 0, 0), "mask applied to client addresses")
+	flags.TextVar(new(netip.Addr), flagDNSServer, &defaultNetworkConfig.dnsServer, "upstream DNS server")
+	flags.IPSlice(flagFallbackDNS, nil, "fallback DNS servers")
+}
+
+func loadNetworkConfig(flags *pflag.FlagSet) (*networkConfig, error) {
+	var bindIP net.IP
+	if bindIPFlag := flags.Lookup(flagBindIP); bindIPFlag == nil || bindIPFlag.Value.String() != "<nil>" {
+		var err error
+		bindIP, err = flags.GetIP(flagBindIP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var allowedNet net.IPNet
+	if allowedNetFlag := flags.Lookup(flagAllowedNet); allowedNetFlag == nil || allowedNetFlag.Value.String() != "<nil>" {
+		var err error
+		allowedNet, err = flags.GetIPNet(flagAllowedNet)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clientMask, err := flags.GetIPv4Mask(flagClientMask)
+	if err != nil {
+		return nil, err
+	}
+
+	var dnsServer netip.Addr
+	if err := flags.GetText(flagDNSServer, &dnsServer); err != nil {
+		return nil, err
+	}
+
+	fallbackDNS, err := flags.GetIPSlice(flagFallbackDNS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &networkConfig{
+		bindIP:      bindIP,
+		allowedNet:  allowedNet,
+		clientMask:  clientMask,
+		dnsServer:   dnsServer,
+		fallbackDNS: fallbackDNS,
+	}, nil
+}
+
+// Ensure unused import is used
+var _ = net.IPv4len
@@ -0,0 +1,25 @@
+//go:generate struct-to-pflags -file=network.go -struct=networkConfig -output=network.gen.go
+
+package example
+
+import (
+	"net"
+	"net/netip"
+)
+
+type networkConfig struct {
+	// address to bind the server
+	bindIP net.IP
+	// network allowed to connect
+	allowedNet net.IPNet
+	// mask applied to client addresses
+	clientMask net.IPMask
+	// upstream DNS server
+	dnsServer netip.Addr
+	// fallback DNS servers
+	fallbackDNS []net.IP
+}
+
+var defaultNetworkConfig = networkConfig{
+	dnsServer: netip.MustParseAddr("1.1.1.1"),
+}
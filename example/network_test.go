@@ -0,0 +1,35 @@
+package example
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Flags left unset keep their defaults, including the nil net.IP and the zero net.IPNet
+func Example_loadNetworkConfig() {
+	flags := pflag.NewFlagSet("example", pflag.ContinueOnError)
+	withNetworkConfigFlags(flags)
+	if err := flags.Parse(nil); err != nil {
+		panic(err)
+	}
+
+	cfg, err := loadNetworkConfig(flags)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.bindIP == nil, cfg.allowedNet.IP == nil, cfg.clientMask, cfg.dnsServer, len(cfg.fallbackDNS))
+
+	if err := flags.Parse([]string{"--bind-ip=10.0.0.1", "--allowed-net=10.0.0.0/8"}); err != nil {
+		panic(err)
+	}
+	cfg, err = loadNetworkConfig(flags)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.bindIP, cfg.allowedNet.String())
+
+	// Output:
+	// true true 00000000 1.1.1.1 0
+	// 10.0.0.1 10.0.0.0/8
+}
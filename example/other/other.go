@@ -0,0 +1,19 @@
+// Package other declares option structs named like the ones of package types
+package other
+
+import "time"
+
+// TLSOptions configures TLS on the client side
+type TLSOptions struct {
+	// verify the server certificate
+	Enabled bool
+	// path to the CA bundle
+	CAFile string
+}
+
+// ClientOptions configures a client, embedding its TLS options
+type ClientOptions struct {
+	// request timeout
+	Timeout    time.Duration
+	TLSOptions `pflags:"prefix=tls"`
+}
@@ -0,0 +1,112 @@
+// Code generated by struct-to-pflags; DO NOT EDIT.
+
+package example
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagAddr       = "listen-addr"
+	flagUpstreams  = "upstreams"
+	flagVerbose    = "verbose"
+	flagFormat     = "format"
+	flagSessionKey = "session-key"
+	flagHTTPPort   = "http-port"
+
+	// tlsOptions flags
+	flagTLSEnabled  = "tls-enabled"
+	flagTLSCertFile = "tls-cert-file"
+)
+
+func withServerConfigFlags(flags *pflag.FlagSet) {
+	flags.StringP(flagAddr, "a", defaultServerConfig.addr, "address to listen on")
+	flags.StringArray(flagUpstreams, nil, "upstream servers, repeat the flag for several")
+	flags.CountP(flagVerbose, "v", "log verbosity")
+	flags.String(flagFormat, string(defaultServerConfig.format), "log format (one of: json, text)")
+	flags.BytesBase64(flagSessionKey, nil, "key signing the session cookies (base64 encoded)")
+	_ = flags.MarkHidden(flagSessionKey)
+	flags.Int(flagHTTPPort, 0, "")
+	_ = flags.MarkDeprecated(flagHTTPPort, "use --listen-addr")
+
+	// tlsOptions flags
+	flags.Bool(flagTLSEnabled, false, "serve HTTPS")
+	flags.String(flagTLSCertFile, "", "path to the certificate file")
+}
+
+func loadServerConfig(flags *pflag.FlagSet) (*serverConfig, error) {
+	var missingFlags []string
+	for _, name := range []string{flagAddr} {
+		if !flags.Changed(name) {
+			missingFlags = append(missingFlags, "--"+name)
+		}
+	}
+	if len(missingFlags) > 0 {
+		return nil, fmt.Errorf("required flags not set: %s", strings.Join(missingFlags, ", "))
+	}
+
+	addr, err := flags.GetString(flagAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreams, err := flags.GetStringArray(flagUpstreams)
+	if err != nil {
+		return nil, err
+	}
+
+	verbose, err := flags.GetCount(flagVerbose)
+	if err != nil {
+		return nil, err
+	}
+
+	formatValue, err := flags.GetString(flagFormat)
+	if err != nil {
+		return nil, err
+	}
+	if flags.Changed(flagFormat) {
+		switch formatValue {
+		case "json", "text":
+		default:
+			return nil, fmt.Errorf("invalid value %v for flag --%s (one of: %s)", formatValue, flagFormat, "json, text")
+		}
+	}
+	format := logFormat(formatValue)
+
+	sessionKey, err := flags.GetBytesBase64(flagSessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	httpPort, err := flags.GetInt(flagHTTPPort)
+	if err != nil {
+		return nil, err
+	}
+
+	// tlsOptions
+	tlsOptionsEnabled, err := flags.GetBool(flagTLSEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsOptionsCertFile, err := flags.GetString(flagTLSCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverConfig{
+		addr:       addr,
+		upstreams:  upstreams,
+		verbose:    verbose,
+		format:     format,
+		sessionKey: sessionKey,
+		httpPort:   httpPort,
+		tlsOptions: tlsOptions{
+			enabled:  tlsOptionsEnabled,
+			certFile: tlsOptionsCertFile,
+		},
+	}, nil
+}
@@ -0,0 +1,41 @@
+//go:generate struct-to-pflags -file=tags.go -struct=serverConfig -output=tags.gen.go
+
+package example
+
+// logFormat is the format of the server logs
+type logFormat string
+
+const (
+	logFormatJSON logFormat = "json"
+	logFormatText logFormat = "text"
+)
+
+// tlsOptions configures TLS
+type tlsOptions struct {
+	// serve HTTPS
+	enabled bool
+	// path to the certificate file
+	certFile string
+}
+
+type serverConfig struct {
+	tlsOptions `pflags:"prefix=tls"`
+
+	// address to listen on
+	addr string `pflags:"name=listen-addr,short=a,required"`
+	// upstream servers
+	upstreams []string `pflags:"array,usage='upstream servers, repeat the flag for several'"`
+	// log verbosity
+	verbose int `pflags:"count"`
+	// log format
+	format logFormat `pflags:"enum"`
+	// key signing the session cookies
+	sessionKey []byte `pflags:"encoding=base64,hidden"`
+	// Deprecated: use --listen-addr
+	httpPort int
+}
+
+var defaultServerConfig = serverConfig{
+	addr:   ":8080",
+	format: logFormatText,
+}
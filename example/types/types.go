@@ -0,0 +1,46 @@
+// Package types declares option structs that the examples nest and embed
+package types
+
+// TLSOptions configures TLS
+type TLSOptions struct {
+	// serve TLS
+	Enabled bool
+	// path to the certificate file
+	CertFile string
+}
+
+// ServerOptions configures a server, embedding its TLS options
+type ServerOptions struct {
+	// address to listen on
+	Addr       string
+	TLSOptions `pflags:"prefix=tls"`
+}
+
+// DefaultServerOptions is used for the fields of embedded ServerOptions
+var DefaultServerOptions = ServerOptions{
+	Addr:       ":8443",
+	TLSOptions: TLSOptions{Enabled: true},
+}
+
+// Endpoint is a remote host
+type Endpoint struct {
+	// host name
+	Host string
+	// port number
+	Port int
+}
+
+// DBConfig configures a database connection
+type DBConfig struct {
+	// database host
+	Host string
+	// database port
+	Port int
+}
+
+// StoreOptions configures a store, nesting its database connection
+type StoreOptions struct {
+	// store name
+	Name string
+	DB   DBConfig
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// markerComment marks a struct for generation with -dir. It takes space-separated options, e.g.
+//
+//	//pflags:generate prefix=db defaults=newDBConfig cobra
+//	type dbConfig struct {
+//		...
+//	}
+const markerComment = "//pflags:generate"
+
+// markerOutputFile is the file generated for the marked structs of a package
+const markerOutputFile = "pflags.gen.go"
+
+// structMarker is a struct marked with //pflags:generate along with its options
+type structMarker struct {
+	StructName string
+	FilePath   string
+	Prefix     string // prefix=<flag name prefix>
+	Defaults   string // defaults=<variable or zero-argument function>
+	Cobra      bool   // cobra
+}
+
+// markedPackage is a package directory holding marked structs
+type markedPackage struct {
+	Dir     string
+	Markers []structMarker
+}
+
+// config returns the generator configuration writing the marked structs of the package to markerOutputFile
+func (p markedPackage) config(cobra bool) *generatorConfig {
+	cfg := &generatorConfig{
+		filePath:     p.Markers[0].FilePath,
+		outputFile:   filepath.Join(p.Dir, markerOutputFile),
+		cobra:        cobra,
+		cobraStructs: make(map[string]bool),
+		dir:          p.Dir,
+	}
+	for _, marker := range p.Markers {
+		cfg.structNames = append(cfg.structNames, marker.StructName)
+		cfg.defaults = append(cfg.defaults, marker.Defaults)
+		cfg.prefixes = append(cfg.prefixes, marker.Prefix)
+		if marker.Cobra {
+			cfg.cobraStructs[marker.StructName] = true
+		}
+	}
+	return cfg
+}
+
+// findMarkedPackages returns the packages with marked structs in a directory, or below it when the pattern ends
+// with /..., e.g. ./...
+func findMarkedPackages(pattern string) ([]markedPackage, error) {
+	var pkgs []markedPackage
+	pkgIndex := make(map[string]int) // directory -> index in pkgs
+	err := walkPackageFiles(pattern, func(path string) error {
+		// Skip generated files
+		if strings.HasSuffix(path, ".gen.go") || strings.HasSuffix(path, "_gen.go") {
+			return nil
+		}
+
+		markers, err := findStructMarkers(path)
+		if err != nil {
+			return err
+		}
+		if len(markers) == 0 {
+			return nil
+		}
+
+		// Walk may visit subdirectories between the files of a directory
+		dir := filepath.Dir(path)
+		i, ok := pkgIndex[dir]
+		if !ok {
+			i = len(pkgs)
+			pkgIndex[dir] = i
+			pkgs = append(pkgs, markedPackage{Dir: dir})
+		}
+		pkgs[i].Markers = append(pkgs[i].Markers, markers...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// findOrphanedOutputs returns the markerOutputFile files matched by a pattern whose package is not one of pkgs,
+// i.e. has no marked structs left
+func findOrphanedOutputs(pattern string, pkgs []markedPackage) ([]string, error) {
+	marked := make(map[string]bool)
+	for _, pkg := range pkgs {
+		marked[pkg.Dir] = true
+	}
+
+	var orphans []string
+	err := walkPackageFiles(pattern, func(path string) error {
+		if filepath.Base(path) == markerOutputFile && !marked[filepath.Dir(path)] {
+			orphans = append(orphans, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// walkPackageFiles calls fn for the non-test Go files in a directory, or below it when the pattern ends with /...
+// Like the go command, it skips vendor and testdata directories and directories starting with . or _.
+func walkPackageFiles(pattern string, fn func(path string) error) error {
+	root, recursive := pattern, false
+	if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+		root, recursive = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/"), true
+		if root == "" {
+			root = "."
+		}
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path == root {
+				return nil
+			}
+			name := info.Name()
+			if !recursive || name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip non-Go and test files
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// findStructMarkers returns the marked structs of a Go file
+func findStructMarkers(filePath string) ([]structMarker, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	// Most files have no markers, there is no need to parse them
+	if !bytes.Contains(src, []byte(markerComment)) {
+		return nil, nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+
+	var markers []structMarker
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			// The marker of a lone type declaration belongs to the declaration, not the spec
+			doc := typeSpec.Doc
+			if doc == nil && len(genDecl.Specs) == 1 {
+				doc = genDecl.Doc
+			}
+			options, ok := markerOptions(doc)
+			if !ok {
+				continue
+			}
+			if _, isStruct := typeSpec.Type.(*ast.StructType); !isStruct {
+				return nil, fmt.Errorf("%s: %s marks %s, which is not a struct", fset.Position(typeSpec.Pos()), markerComment, typeSpec.Name.Name)
+			}
+
+			marker, err := parseStructMarker(options)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fset.Position(typeSpec.Pos()), err)
+			}
+			marker.StructName = typeSpec.Name.Name
+			marker.FilePath = filePath
+			markers = append(markers, marker)
+		}
+	}
+	return markers, nil
+}
+
+// markerOptions returns the options of the //pflags:generate line of a doc comment, if it has one
+func markerOptions(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, comment := range doc.List {
+		if comment.Text == markerComment {
+			return "", true
+		}
+		if options, ok := strings.CutPrefix(comment.Text, markerComment+" "); ok {
+			return options, true
+		}
+	}
+	return "", false
+}
+
+// parseStructMarker parses the options of a //pflags:generate marker
+func parseStructMarker(options string) (structMarker, error) {
+	var marker structMarker
+	for _, option := range strings.Fields(options) {
+		key, val, hasValue := strings.Cut(option, "=")
+		switch key {
+		case "prefix":
+			marker.Prefix = val
+		case "defaults":
+			marker.Defaults = val
+		case "cobra":
+			marker.Cobra = true
+		default:
+			return marker, fmt.Errorf("unknown %s option %q", markerComment, key)
+		}
+
+		if hasValue != (key != "cobra") || (hasValue && val == "") {
+			return marker, fmt.Errorf("invalid %s option %q", markerComment, option)
+		}
+	}
+	return marker, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindStructMarkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []structMarker
+		wantErr bool
+	}{
+		{
+			name: "no markers",
+			src: `package p
+
+type config struct{}
+`,
+		},
+		{
+			name: "lone declaration",
+			src: `package p
+
+// config configures the server.
+//
+//pflags:generate prefix=db defaults=newConfig cobra
+type config struct{}
+`,
+			want: []structMarker{{StructName: "config", Prefix: "db", Defaults: "newConfig", Cobra: true}},
+		},
+		{
+			name: "grouped declarations",
+			src: `package p
+
+type (
+	//pflags:generate
+	serverConfig struct{}
+
+	other struct{}
+
+	//pflags:generate prefix=worker
+	workerConfig struct{}
+)
+`,
+			want: []structMarker{{StructName: "serverConfig"}, {StructName: "workerConfig", Prefix: "worker"}},
+		},
+		{
+			name: "group marker does not mark its declarations",
+			src: `package p
+
+//pflags:generate
+type (
+	serverConfig struct{}
+	workerConfig struct{}
+)
+`,
+		},
+		{
+			name: "marker in a regular comment",
+			src: `package p
+
+// The //pflags:generate marker goes right above the struct.
+type config struct{}
+`,
+		},
+		{
+			name: "cobra with a value",
+			src: `package p
+
+//pflags:generate cobra=true
+type config struct{}
+`,
+			wantErr: true,
+		},
+		{
+			name: "empty prefix",
+			src: `package p
+
+//pflags:generate prefix=
+type config struct{}
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown option",
+			src: `package p
+
+//pflags:generate output=config.gen.go
+type config struct{}
+`,
+			wantErr: true,
+		},
+		{
+			name: "non-struct",
+			src: `package p
+
+//pflags:generate
+type mode string
+`,
+			wantErr: true,
+		},
+		{
+			name: "non-struct in a group",
+			src: `package p
+
+type (
+	config struct{}
+
+	//pflags:generate
+	modes []string
+)
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.go")
+			if err := os.WriteFile(filePath, []byte(tt.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := findStructMarkers(filePath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("findStructMarkers() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findStructMarkers() failed: %v", err)
+			}
+			for i := range tt.want {
+				tt.want[i].FilePath = filePath
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findStructMarkers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindOrphanedOutputs(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"marked/config.go":        "package marked\n\n//pflags:generate\ntype config struct{}\n",
+		"marked/pflags.gen.go":    "package marked\n",
+		"orphan/config.go":        "package orphan\n\ntype config struct{}\n",
+		"orphan/pflags.gen.go":    "package orphan\n",
+		"testdata/pflags.gen.go":  "package testdata\n",
+		"unrelated/config.gen.go": "package unrelated\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pattern := root + "/..."
+	pkgs, err := findMarkedPackages(pattern)
+	if err != nil {
+		t.Fatalf("findMarkedPackages() failed: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Dir != filepath.Join(root, "marked") {
+		t.Fatalf("findMarkedPackages() = %+v, want the marked package only", pkgs)
+	}
+
+	orphans, err := findOrphanedOutputs(pattern, pkgs)
+	if err != nil {
+		t.Fatalf("findOrphanedOutputs() failed: %v", err)
+	}
+	want := []string{filepath.Join(root, "orphan", markerOutputFile)}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("findOrphanedOutputs() = %v, want %v", orphans, want)
+	}
+}
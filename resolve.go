@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Value kinds for field types that have no dedicated pflag type
+const (
+	valueKindPflag = "pflag" // the type implements pflag.Value
+	valueKindText  = "text"  // the type implements encoding.TextMarshaler and encoding.TextUnmarshaler
+)
+
+// loadMode is what the generator needs of every package it looks into: syntax for comments, struct tags and
+// defaults, and type information for everything else
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedSyntax | packages.NeedTypes |
+	packages.NeedTypesInfo
+
+// generatedCodeImports are the packages referenced by the generated code itself, which keep their names
+var generatedCodeImports = []string{"fmt", "strings", "net", "time", "github.com/spf13/pflag", "github.com/spf13/cobra"}
+
+// typeResolver loads packages with go/packages and resolves field types with go/types
+type typeResolver struct {
+	dir  string            // directory go/packages runs in, so that the module and vendoring are honored
+	root *packages.Package // package of the source file, the generated code goes there
+	// import path -> loaded package
+	pkgs map[string]*packages.Package
+	// import path -> package name in the generated code, and back
+	names map[string]string
+	paths map[string]string
+	// nested structs being expanded, outermost first, to detect nesting cycles
+	nesting []string
+}
+
+// errNestingCycle is returned for structs that contain themselves, directly or through other nested structs
+var errNestingCycle = errors.New("nested struct cycle")
+
+func newTypeResolver(dir string) *typeResolver {
+	r := &typeResolver{
+		dir:   dir,
+		pkgs:  make(map[string]*packages.Package),
+		names: make(map[string]string),
+		paths: make(map[string]string),
+	}
+	for _, importPath := range generatedCodeImports {
+		r.names[importPath] = path.Base(importPath)
+		r.paths[path.Base(importPath)] = importPath
+	}
+	return r
+}
+
+// loadFile loads the package containing a Go file as the package of the generated code
+func (r *typeResolver) loadFile(filePath string) (*packages.Package, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := r.load("file="+absPath, absPath)
+	if err != nil {
+		return nil, err
+	}
+	r.root = pkg
+	r.pkgs[pkg.PkgPath] = pkg
+	return pkg, nil
+}
+
+// loadPackage loads an imported package, caching the result. The empty path is the package of the generated code.
+func (r *typeResolver) loadPackage(importPath string) (*packages.Package, error) {
+	if importPath == "" {
+		return r.root, nil
+	}
+	if pkg, ok := r.pkgs[importPath]; ok {
+		return pkg, nil
+	}
+	pkg, err := r.load(importPath, "")
+	if err != nil {
+		return nil, err
+	}
+	r.pkgs[importPath] = pkg
+	return pkg, nil
+}
+
+// load loads the single package matching pattern. Type errors are ignored: the package being generated for
+// usually does not type check until its generated code is up to date. Neither do syntax errors outside of
+// structFile matter, e.g. in a truncated previous output, nor does the compiler failing on the package.
+func (r *typeResolver) load(pattern, structFile string) (*packages.Package, error) {
+	pkgs, err := packages.Load(&packages.Config{Mode: loadMode, Dir: r.dir}, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", pattern, err)
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("failed to load %s: found %d packages", pattern, len(pkgs))
+	}
+
+	pkg := pkgs[0]
+	for _, pkgErr := range pkg.Errors {
+		if pkgErr.Kind == packages.TypeError {
+			continue
+		}
+		// go list reports the compiler output, e.g. "# example.com/pkg\n./config.gen.go:75:3: unknown field ..."
+		if structFile != "" && strings.HasPrefix(pkgErr.Msg, "# "+pkg.PkgPath+"\n") {
+			continue
+		}
+		if file := r.errorFile(pkgErr); structFile != "" && file != "" && file != structFile {
+			continue
+		}
+		return nil, fmt.Errorf("failed to load %s: %v", pattern, pkgErr)
+	}
+	if pkg.Types == nil || pkg.TypesInfo == nil {
+		return nil, fmt.Errorf("failed to load %s: no type information", pattern)
+	}
+	return pkg, nil
+}
+
+// errorFile returns the absolute path of the file a package error is reported at, empty if there is none
+func (r *typeResolver) errorFile(pkgErr packages.Error) string {
+	file, _, ok := strings.Cut(pkgErr.Pos, ":")
+	if !ok || file == "" || file == "-" {
+		return ""
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(r.dir, file)
+	}
+	if absFile, err := filepath.Abs(file); err == nil {
+		file = absFile
+	}
+	return file
+}
+
+// declaringPackage loads the package declaring a named type
+func (r *typeResolver) declaringPackage(named *types.Named) (*packages.Package, error) {
+	obj := named.Obj()
+	if obj.Pkg() == nil {
+		return nil, fmt.Errorf("%s is a predeclared type", obj.Name())
+	}
+	if obj.Pkg().Path() == r.root.PkgPath {
+		return r.root, nil
+	}
+	return r.loadPackage(obj.Pkg().Path())
+}
+
+// packageName returns the name a package is referred to by in the generated code, empty for the package of the
+// generated code. Packages sharing a name are told apart by a numeric suffix, e.g. types2.
+func (r *typeResolver) packageName(pkg *types.Package) string {
+	if pkg.Path() == r.root.PkgPath {
+		return ""
+	}
+	if name, ok := r.names[pkg.Path()]; ok {
+		return name
+	}
+
+	name := pkg.Name()
+	for i := 2; r.paths[name] != ""; i++ {
+		name = pkg.Name() + strconv.Itoa(i)
+	}
+	r.names[pkg.Path()] = name
+	r.paths[name] = pkg.Path()
+	return name
+}
+
+// typeString formats a type as written in the generated code, recording the imports it needs
+func (r *typeResolver) typeString(t types.Type, imports map[string]string) string {
+	return types.TypeString(t, func(pkg *types.Package) string {
+		name := r.packageName(pkg)
+		if name != "" {
+			imports[name] = pkg.Path()
+		}
+		return name
+	})
+}
+
+// typeSpec finds the declaration of a named type in a loaded package
+func typeSpec(pkg *packages.Package, typeName string) *ast.TypeSpec {
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if ok && typeSpec.Name.Name == typeName {
+					return typeSpec
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// structDecl finds the declaration of a struct type in a loaded package
+func structDecl(pkg *packages.Package, typeName string) (*ast.StructType, error) {
+	spec := typeSpec(pkg, typeName)
+	if spec == nil {
+		return nil, fmt.Errorf("struct %s not found in package %s", typeName, pkg.PkgPath)
+	}
+	structType, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s in package %s is not a struct", typeName, pkg.PkgPath)
+	}
+	return structType, nil
+}
+
+// newField builds the fieldInfo of a struct field declared in pkg, resolving how its type is registered
+func (r *typeResolver) newField(pkg *packages.Package, field *ast.Field) (fieldInfo, error) {
+	info, err := newFieldInfo(field)
+	if err != nil {
+		return info, err
+	}
+
+	t := pkg.TypesInfo.TypeOf(field.Type)
+	if t == nil || t == types.Typ[types.Invalid] {
+		return info, fmt.Errorf("field %s: could not determine its type", info.Name)
+	}
+	t = types.Unalias(t)
+	// Pointer fields are optional: the flag has the element type and the field is only set when the flag is
+	if pointer, ok := t.(*types.Pointer); ok {
+		info.Pointer = true
+		t = types.Unalias(pointer.Elem())
+	}
+
+	info.Imports = make(map[string]string)
+	info.Type = r.typeString(t, info.Imports)
+	// byte is an alias for uint8, so both slices are byte flags
+	if info.Type == "[]uint8" {
+		info.Type = "[]byte"
+	}
+
+	if !info.Skip && !hasPflagType(info.Type) {
+		if err := r.resolveField(&info, t); err != nil {
+			return info, fmt.Errorf("field %s: %w", info.Name, err)
+		}
+	}
+	return info, checkTagOptions(info)
+}
+
+// resolveField resolves how a field whose type has no dedicated pflag type is registered
+func (r *typeResolver) resolveField(field *fieldInfo, t types.Type) error {
+	if textFlagTypes[field.Type] {
+		field.ValueKind = valueKindText
+		return nil
+	}
+
+	named, ok := t.(*types.Named)
+	if !ok || named.TypeArgs().Len() > 0 {
+		return fmt.Errorf("unsupported type %s, skip the field with `pflags:\"-\"`", field.Type)
+	}
+
+	if kind := valueKind(named); kind != "" {
+		field.ValueKind = kind
+		return nil
+	}
+
+	if _, ok := named.Underlying().(*types.Struct); ok {
+		return r.resolveNestedStruct(field, named)
+	}
+
+	underlying, err := r.underlyingType(named, field.Imports)
+	if err != nil {
+		return err
+	}
+	if underlying == "" {
+		return fmt.Errorf("unsupported type %s, skip the field with `pflags:\"-\"`", field.Type)
+	}
+	field.UnderlyingType = underlying
+
+	if field.Tag.Enum {
+		values, names, err := r.enumValues(named)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("no constants of type %s found for enum field %s", field.Type, field.Name)
+		}
+		field.EnumValues, field.EnumNames = values, names
+	}
+	return nil
+}
+
+// valueKind reports whether a named type can be registered through pflag.Value or TextVar
+func valueKind(named *types.Named) string {
+	methods := types.NewMethodSet(types.NewPointer(named))
+	has := func(name string) bool {
+		return methods.Lookup(named.Obj().Pkg(), name) != nil
+	}
+
+	switch {
+	case has("Set") && has("String") && has("Type"):
+		return valueKindPflag
+	case has("UnmarshalText") && has("MarshalText"):
+		return valueKindText
+	default:
+		return ""
+	}
+}
+
+// resolveNestedStruct expands a field of a named struct type into the fields of that struct, including the
+// structs it embeds
+func (r *typeResolver) resolveNestedStruct(field *fieldInfo, named *types.Named) error {
+	key := named.Obj().Pkg().Path() + "." + named.Obj().Name()
+	for _, outer := range r.nesting {
+		if outer == key {
+			return fmt.Errorf("%w: %s -> %s, skip one of the fields with `pflags:\"-\"`", errNestingCycle, strings.Join(r.nesting, " -> "), key)
+		}
+	}
+	r.nesting = append(r.nesting, key)
+	defer func() { r.nesting = r.nesting[:len(r.nesting)-1] }()
+
+	pkg, err := r.declaringPackage(named)
+	if err != nil {
+		return err
+	}
+	structType, err := structDecl(pkg, named.Obj().Name())
+	if err != nil {
+		return err
+	}
+
+	var fields []fieldInfo
+	for _, f := range structType.Fields.List {
+		if len(f.Names) == 0 {
+			embedded, ok, err := r.newEmbeddedField(pkg, f)
+			if err != nil {
+				return fmt.Errorf("%s: %w", field.Type, err)
+			}
+			if ok {
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		// Unexported fields of a struct from another package cannot be set by the generated code
+		if pkg != r.root && !f.Names[0].IsExported() {
+			continue
+		}
+		info, err := r.newField(pkg, f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.Type, err)
+		}
+		fields = append(fields, info)
+	}
+
+	field.IsStruct = true
+	field.Fields = fields
+	return nil
+}
+
+// newEmbeddedField describes a struct embedded in a nested struct as a nested struct field named after its type,
+// or returns false if the field does not embed a struct the generated code can set
+func (r *typeResolver) newEmbeddedField(pkg *packages.Package, field *ast.Field) (fieldInfo, bool, error) {
+	embedded, ok, err := embeddedType(r, pkg, field)
+	if err != nil || !ok {
+		return fieldInfo{}, false, err
+	}
+	if pkg != r.root && !ast.IsExported(embedded.TypeName) {
+		return fieldInfo{}, false, nil
+	}
+
+	info := fieldInfo{
+		Name:       embedded.TypeName,
+		Tag:        embedded.Tag,
+		Skip:       embedded.Tag.Skip,
+		Pointer:    embedded.Pointer,
+		IsEmbedded: true,
+		Imports:    make(map[string]string),
+	}
+	t := types.Unalias(pkg.TypesInfo.TypeOf(field.Type))
+	if pointer, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(pointer.Elem())
+	}
+	info.Type = r.typeString(t, info.Imports)
+	if info.Skip {
+		return info, true, nil
+	}
+	if err := r.resolveNestedStruct(&info, t.(*types.Named)); err != nil {
+		return info, false, fmt.Errorf("embedded %s: %w", info.Name, err)
+	}
+	return info, true, nil
+}
+
+// maxUnderlyingDepth bounds how many named types are followed when resolving an underlying type
+const maxUnderlyingDepth = 10
+
+// underlyingType resolves a named type to the first type in its definition chain that pflag supports,
+// e.g. "Port" declared as `type Port uint16` resolves to "uint16" and `type timeout time.Duration` to
+// "time.Duration". The imports of the resolved type are added to imports.
+func (r *typeResolver) underlyingType(named *types.Named, imports map[string]string) (string, error) {
+	for depth := 0; depth < maxUnderlyingDepth; depth++ {
+		pkg, err := r.declaringPackage(named)
+		if err != nil {
+			return "", err
+		}
+
+		// go/types only keeps the underlying type, the declaration has the type the named type is defined as
+		definition := named.Underlying()
+		if spec := typeSpec(pkg, named.Obj().Name()); spec != nil {
+			if t := pkg.TypesInfo.TypeOf(spec.Type); t != nil {
+				definition = types.Unalias(t)
+			}
+		}
+
+		definitionImports := make(map[string]string)
+		goType := r.typeString(definition, definitionImports)
+		if hasPflagType(goType) {
+			for name, importPath := range definitionImports {
+				imports[name] = importPath
+			}
+			return goType, nil
+		}
+
+		next, ok := definition.(*types.Named)
+		if !ok {
+			return "", nil
+		}
+		named = next
+	}
+	return "", fmt.Errorf("underlying type of %s is nested too deeply", named.Obj().Name())
+}
+
+// enumValues returns the values of the constants declared with a named type, as Go literals in declaration
+// order, along with the names the generated code refers to them by, e.g. types.ModeFast
+func (r *typeResolver) enumValues(named *types.Named) ([]string, []string, error) {
+	pkg, err := r.declaringPackage(named)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Compare against the type as loaded with its package, which declares the constants
+	typeName, ok := pkg.Types.Scope().Lookup(named.Obj().Name()).(*types.TypeName)
+	if !ok {
+		return nil, nil, fmt.Errorf("type %s not found in package %s", named.Obj().Name(), pkg.PkgPath)
+	}
+
+	// Constants of another package are referred to by their qualified name, so only exported ones are usable
+	qualifier := r.packageName(pkg.Types)
+	var consts []*types.Const
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		if ok && types.Identical(c.Type(), typeName.Type()) && (qualifier == "" || c.Exported()) {
+			consts = append(consts, c)
+		}
+	}
+	sort.Slice(consts, func(i, j int) bool {
+		pi, pj := pkg.Fset.Position(consts[i].Pos()), pkg.Fset.Position(consts[j].Pos())
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+
+	var values, names []string
+	seen := make(map[string]bool)
+	for _, c := range consts {
+		value := c.Val().ExactString()
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+		if qualifier != "" {
+			names = append(names, qualifier+"."+c.Name())
+		} else {
+			names = append(names, c.Name())
+		}
+	}
+	return values, names, nil
+}
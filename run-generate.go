@@ -2,18 +2,23 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
 	"go/format"
-	"go/parser"
 	"go/token"
+	"go/types"
 	"log"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
+
+	"golang.org/x/tools/go/packages"
 )
 
 type fieldInfo struct {
@@ -23,6 +28,15 @@ type fieldInfo struct {
 	Skip            bool
 	DefaultValue    string
 	DefaultValueRef string
+	Tag             pflagsTag         // options from the pflags struct tag
+	EnumValues      []string          // Go literals of the constants declared with the field's type
+	EnumNames       []string          // names of those constants, qualified when declared in another package
+	Pointer         bool              // true for optional *T fields; Type then holds T
+	IsStruct        bool              // true for fields of a named struct type, expanded into prefixed flags
+	Fields          []fieldInfo       // fields of the nested struct when IsStruct is set
+	ValueKind       string            // valueKindPflag or valueKindText for types without a dedicated pflag type
+	UnderlyingType  string            // basic type behind a named type such as `type Port uint16`
+	Imports         map[string]string // package alias -> import path for packages referenced by Type
 	// For embedded struct fields
 	IsEmbedded       bool   // true if this is an embedded struct
 	EmbeddedTypeName string // the type name (e.g., "EmbeddedDefaults")
@@ -31,43 +45,87 @@ type fieldInfo struct {
 }
 
 type embeddedStructInfo struct {
-	TypeName  string // e.g., "EmbeddedDefaults"
-	PkgAlias  string // e.g., "types"
-	PkgPath   string // e.g., "github.com/example/pkg/types"
-	Fields    []fieldInfo
-	FilePath  string // resolved file path
+	TypeName string // e.g., "EmbeddedDefaults"
+	PkgAlias string // e.g., "types"
+	PkgPath  string // e.g., "github.com/example/pkg/types"
+	Fields   []fieldInfo
+	FilePath string               // resolved file path
+	Embedded []embeddedStructInfo // structs embedded in this one
+	Pointer  bool                 // embedded as *T, allocated by load<Struct>
+	Tag      pflagsTag            // prefix= and inline control the flag names
 }
 
 type generatorConfig struct {
 	filePath    string
-	structName  string
+	structNames []string
 	outputFile  string
 	packageName string
+	cobra       bool
+	defaults    []string // paired with structNames, empty entries fall back to default<Struct>
+	prefixes    []string // paired with structNames, flag name prefixes
+	// structs annotated for cobra even without cobra, from //pflags:generate cobra
+	cobraStructs map[string]bool
+	// package directory pattern of -dir, or the package directory of the marked structs of this config
+	dir string
+}
+
+// listFlag is a string list flag accepting comma-separated and repeated values, e.g. -struct a,b -struct c
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, strings.Split(value, ",")...)
+	return nil
 }
 
 func parseFlags() *generatorConfig {
 	var (
 		filePath    = flag.String("file", "", "path to Go file containing the struct")
-		structName  = flag.String("struct", "", "name of the struct to convert")
 		outputFile  = flag.String("output", "", "path to output file (if empty, prints to stdout)")
 		packageName = flag.String("package", "", "package name for generated code (if empty, extracted from input file)")
+		cobra       = flag.Bool("cobra", false, "annotate required flags for cobra help and shell completion")
+		dir         = flag.String("dir", "", "generate "+markerOutputFile+" for the structs marked with "+markerComment+" in a package directory, or below it with /...")
+		structNames listFlag
+		defaults    listFlag
+		prefixes    listFlag
 	)
+	flag.Var(&structNames, "struct", "name of the struct to convert (comma-separated or repeated for several structs)")
+	flag.Var(&defaults, "defaults", "variables or zero-argument functions holding the default values, one per struct (if empty, default<Struct>)")
+	flag.Var(&prefixes, "prefix", "flag name prefixes, one per struct")
 	flag.Parse()
 
-	if *filePath == "" || *structName == "" {
+	if *dir != "" {
+		if *filePath != "" || len(structNames) > 0 || *outputFile != "" || *packageName != "" || len(defaults) > 0 || len(prefixes) > 0 {
+			log.Fatal("-dir takes the structs and their options from " + markerComment + " markers, it cannot be combined with -file, -struct, -output, -package, -defaults or -prefix")
+		}
+		return &generatorConfig{cobra: *cobra, dir: *dir}
+	}
+
+	if *filePath == "" || len(structNames) == 0 {
 		log.Fatal("both -file and -struct flags are required")
 	}
 
 	return &generatorConfig{
 		filePath:    *filePath,
-		structName:  *structName,
+		structNames: structNames,
 		outputFile:  *outputFile,
 		packageName: *packageName,
+		cobra:       *cobra,
+		defaults:    defaults,
+		prefixes:    prefixes,
 	}
 }
 
 func generate() {
 	cfg := parseFlags()
+	if cfg.dir != "" {
+		generateDir(cfg)
+		return
+	}
+
 	code, err := generateCode(cfg)
 	if err != nil {
 		log.Fatal(err)
@@ -83,370 +141,489 @@ func generate() {
 	}
 }
 
+// generateDir writes the code for the marked structs of every package matching cfg.dir
+func generateDir(cfg *generatorConfig) {
+	pkgs, err := findMarkedPackages(cfg.dir)
+	if err != nil {
+		log.Fatalf("failed to find %s markers: %v", markerComment, err)
+	}
+	if len(pkgs) == 0 {
+		log.Fatalf("no %s markers found in %s", markerComment, cfg.dir)
+	}
+
+	for _, pkg := range pkgs {
+		pkgCfg := pkg.config(cfg.cobra)
+		code, err := generateCode(pkgCfg)
+		if err != nil {
+			log.Fatalf("%s: %v", pkg.Dir, err)
+		}
+		if err := os.WriteFile(pkgCfg.outputFile, []byte(code), 0644); err != nil {
+			log.Fatalf("failed to write output file: %v", err)
+		}
+	}
+}
+
 func generateCode(cfg *generatorConfig) (string, error) {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, cfg.filePath, nil, parser.ParseComments)
+	if len(cfg.defaults) > 0 && len(cfg.defaults) != len(cfg.structNames) {
+		return "", fmt.Errorf("-defaults lists %d values for %d structs", len(cfg.defaults), len(cfg.structNames))
+	}
+	if len(cfg.prefixes) > 0 && len(cfg.prefixes) != len(cfg.structNames) {
+		return "", fmt.Errorf("-prefix lists %d values for %d structs", len(cfg.prefixes), len(cfg.structNames))
+	}
+
+	resolver := newTypeResolver(filepath.Dir(cfg.filePath))
+	root, err := resolver.loadFile(cfg.filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse file: %w", err)
+		return "", fmt.Errorf("failed to load package: %w", err)
 	}
 
 	// Extract package name if not provided
 	pkg := cfg.packageName
 	if pkg == "" {
-		pkg = node.Name.Name
+		pkg = root.Name
+	}
+
+	var structs []structFlags
+	seen := make(map[string]bool)
+	for i, structName := range cfg.structNames {
+		if seen[structName] {
+			return "", fmt.Errorf("struct %s is listed more than once", structName)
+		}
+		seen[structName] = true
+
+		var defaultsName string
+		if len(cfg.defaults) > 0 {
+			defaultsName = cfg.defaults[i]
+		}
+		s, err := extractStructFlags(resolver, structName, defaultsName)
+		if err != nil {
+			if len(cfg.structNames) > 1 {
+				err = fmt.Errorf("%s: %w", structName, err)
+			}
+			return "", err
+		}
+		if len(cfg.prefixes) > 0 {
+			s.Prefix = cfg.prefixes[i]
+		}
+		s.Cobra = cfg.cobra || cfg.cobraStructs[structName]
+		structs = append(structs, s)
+	}
+
+	// The generated constants share the file, and the structs may share a flag set
+	if err := checkFlagNames(structs); err != nil {
+		return "", err
+	}
+
+	// Generate code
+	return generatePflagsCode(structs, pkg), nil
+}
+
+// structFlags is everything needed to generate the flags of one struct
+type structFlags struct {
+	Name         string
+	Fields       []fieldInfo
+	Embedded     []embeddedStructInfo
+	DefaultsCall string // function returning the defaults, called once by with<Struct>Flags
+	Prefix       string // prepended to every flag name, e.g. db for --db-host
+	Cobra        bool   // annotate required flags for cobra
+}
+
+// flagFields returns the flags of the regular and nested fields of the struct
+func (s structFlags) flagFields() []flagField {
+	return prefixFlagFields(flattenFields(s.Fields), s.Prefix)
+}
+
+// embeddedFlagFields returns the flags of the fields of the structs embedded in the struct
+func (s structFlags) embeddedFlagFields() []flagField {
+	return prefixFlagFields(embeddedFlagFields(s.Embedded), s.Prefix)
+}
+
+// prefixFlagFields prepends a prefix to the flag and constant names of fields, e.g. --host (flagHost) becomes
+// --db-host (flagDbHost)
+func prefixFlagFields(fields []flagField, prefix string) []flagField {
+	if prefix == "" {
+		return fields
 	}
+	for i := range fields {
+		fields[i].FlagName = prefix + "-" + fields[i].FlagName
+		fields[i].ConstName = "flag" + kebabToConstName(prefix) + strings.TrimPrefix(fields[i].ConstName, "flag")
+	}
+	return fields
+}
 
-	structFields, err := extractStructFields(node, cfg.structName)
+// extractStructFlags resolves the fields, embedded structs and defaults of a struct of the package being
+// generated for. The struct and its defaults may be declared in any file of the package.
+func extractStructFlags(resolver *typeResolver, structName, defaultsName string) (structFlags, error) {
+	structFields, err := extractStructFields(resolver, structName)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract struct fields: %w", err)
+		return structFlags{}, fmt.Errorf("failed to extract struct fields: %w", err)
 	}
 
-	defaults, err := extractDefaults(node, cfg.structName)
+	defaults, err := extractDefaults(resolver.root.Syntax, structName, defaultsName)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract defaults: %w", err)
+		return structFlags{}, fmt.Errorf("failed to extract defaults: %w", err)
 	}
 
 	// Merge defaults with struct fields
-	for i := range structFields {
-		if val, ok := defaults[structFields[i].Name]; ok {
-			structFields[i].DefaultValueRef = val
-		}
-	}
+	mergeDefaults(structFields, defaults)
 
 	// Extract embedded structs
-	embeddedStructs, err := extractEmbeddedStructs(node, cfg.structName, cfg.filePath)
+	embeddedStructs, err := extractEmbeddedStructs(resolver, structName)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract embedded structs: %w", err)
+		return structFlags{}, fmt.Errorf("failed to extract embedded structs: %w", err)
 	}
 
+	// Nested struct fields default to the matching fields of their parent's default
+	propagateDefaults(structFields)
+
 	// Merge defaults with embedded struct fields
-	defaultVarName := "default" + strings.Title(cfg.structName)
-	for i := range embeddedStructs {
-		for j := range embeddedStructs[i].Fields {
-			// Embedded fields are accessed directly: defaultConfig.FieldName
-			embeddedStructs[i].Fields[j].DefaultValueRef = defaultVarName + "." + embeddedStructs[i].Fields[j].Name
-		}
+	if err := propagateEmbeddedDefaults(resolver, embeddedStructs, defaults); err != nil {
+		return structFlags{}, fmt.Errorf("failed to extract embedded defaults: %w", err)
 	}
 
-	// Generate code
-	return generatePflagsCode(structFields, embeddedStructs, cfg.structName, pkg), nil
+	s := structFlags{Name: structName, Fields: structFields, Embedded: embeddedStructs}
+	if defaults != nil {
+		s.DefaultsCall = defaults.Call
+	}
+	return s, nil
 }
 
-func extractStructFields(node *ast.File, structName string) ([]fieldInfo, error) {
-	var fields []fieldInfo
-	var found bool
+// extractStructFields returns the named fields of a struct of the package being generated for, with their
+// types resolved
+func extractStructFields(resolver *typeResolver, structName string) ([]fieldInfo, error) {
+	structType, err := structDecl(resolver.root, structName)
+	if err != nil {
+		return nil, err
+	}
 
-	ast.Inspect(node, func(n ast.Node) bool {
-		typeSpec, ok := n.(*ast.TypeSpec)
-		if !ok || typeSpec.Name.Name != structName {
-			return true
+	var fields []fieldInfo
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			continue
 		}
 
-		structType, ok := typeSpec.Type.(*ast.StructType)
-		if !ok {
-			return true
+		info, err := resolver.newField(resolver.root, field)
+		if err != nil {
+			return nil, err
 		}
+		fields = append(fields, info)
+	}
+	return fields, nil
+}
 
-		found = true
-		for _, field := range structType.Fields.List {
-			if len(field.Names) == 0 {
-				continue
-			}
+// newFieldInfo builds a fieldInfo from a named struct field, reading its pflags tag and comment.
+// Its type is filled in by typeResolver.newField.
+func newFieldInfo(field *ast.Field) (fieldInfo, error) {
+	info := fieldInfo{
+		Name: field.Names[0].Name,
+	}
 
-			fieldName := field.Names[0].Name
-			fieldType := getTypeString(field.Type)
+	if field.Tag != nil {
+		tag, err := parseStructTag(field.Tag.Value)
+		if err != nil {
+			return info, fmt.Errorf("field %s: %w", info.Name, err)
+		}
+		info.Tag = tag
+		if tag.Prefix != "" || tag.Inline {
+			return info, fmt.Errorf("field %s: prefix and inline only apply to embedded structs", info.Name)
+		}
+		info.Skip = tag.Skip
+	}
 
-			// Check for pflags:"-" tag
-			skip := false
-			if field.Tag != nil {
-				tagValue := field.Tag.Value
-				if strings.Contains(tagValue, `pflags:"-"`) {
-					skip = true
+	// Extract comment
+	var comments []*ast.Comment
+	if field.Doc != nil && len(field.Doc.List) > 0 {
+		comments = field.Doc.List
+	} else if field.Comment != nil && len(field.Comment.List) > 0 {
+		comments = field.Comment.List
+	}
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		// A standard "Deprecated:" line marks the flag deprecated instead of becoming its usage
+		if message, ok := strings.CutPrefix(text, "Deprecated:"); ok {
+			if info.Tag.Deprecated == "" {
+				info.Tag.Deprecated = strings.TrimSpace(message)
+				if info.Tag.Deprecated == "" {
+					info.Tag.Deprecated = defaultDeprecationMessage
 				}
 			}
+			continue
+		}
+		if info.Comment == "" {
+			info.Comment = strings.Trim(text, `"`)
+		}
+	}
+	if info.Tag.Usage != "" {
+		info.Comment = info.Tag.Usage
+	}
+
+	return info, nil
+}
 
-			// Extract comment
-			comment := ""
-			if field.Doc != nil && len(field.Doc.List) > 0 {
-				comment = strings.TrimSpace(field.Doc.List[0].Text)
-				comment = strings.TrimPrefix(comment, "//")
-				comment = strings.TrimSpace(comment)
-				comment = strings.Trim(comment, `"`)
-			} else if field.Comment != nil && len(field.Comment.List) > 0 {
-				comment = strings.TrimSpace(field.Comment.List[0].Text)
-				comment = strings.TrimPrefix(comment, "//")
-				comment = strings.TrimSpace(comment)
-				comment = strings.Trim(comment, `"`)
+// checkTagOptions reports pflags tag options that do not apply to the resolved type of a field, e.g. count on a
+// string, instead of silently ignoring them
+func checkTagOptions(field fieldInfo) error {
+	goType := flagGoType(field)
+	switch {
+	case field.Skip:
+	case field.Tag.Count && goType != "int":
+		return fmt.Errorf("field %s: count only applies to int fields, not %s", field.Name, field.Type)
+	case field.Tag.Array && goType != "[]string":
+		return fmt.Errorf("field %s: array only applies to []string fields, not %s", field.Name, field.Type)
+	case field.Tag.Encoding != "" && goType != "[]byte":
+		return fmt.Errorf("field %s: encoding only applies to []byte fields, not %s", field.Name, field.Type)
+	case field.Tag.Enum && len(field.EnumValues) == 0:
+		return fmt.Errorf("field %s: enum only applies to named types with constants, such as `type mode string`, not %s", field.Name, field.Type)
+	}
+
+	// The flag values of namedEnum constants are derived from their names, which may collide
+	if namedEnum(field) {
+		owners := make(map[string]string)
+		for _, name := range field.EnumNames {
+			value := enumFlagValue(field, name)
+			if other, ok := owners[value]; ok {
+				return fmt.Errorf("field %s: enum constants %s and %s both take the value %q", field.Name, other, name, value)
 			}
+			owners[value] = name
+		}
+	}
+	return nil
+}
+
+// defaultsLocalVar holds the result of the defaults function in with<Struct>Flags
+const defaultsLocalVar = "defaults"
 
-			fields = append(fields, fieldInfo{
-				Name:    fieldName,
-				Type:    fieldType,
-				Comment: comment,
-				Skip:    skip,
-			})
+// extractDefaults finds the default values of the struct: the variable or zero-argument function named name,
+// or the default<Struct> variable when name is empty. It returns nil when there are none.
+func extractDefaults(files []*ast.File, structName, name string) (*defaultValue, error) {
+	if name == "" {
+		varName, value := findVar(files, "default"+strings.Title(structName))
+		if value == nil {
+			return nil, nil
 		}
+		return &defaultValue{Ref: varName, Lit: compositeLiteral(value)}, nil
+	}
 
-		return false
-	})
+	if _, value := findVar(files, name); value != nil {
+		return &defaultValue{Ref: name, Lit: compositeLiteral(value)}, nil
+	}
 
-	if !found {
-		return nil, fmt.Errorf("struct %s not found", structName)
+	funcDecl := findFunc(files, name)
+	if funcDecl == nil {
+		return nil, fmt.Errorf("no variable or function named %s", name)
+	}
+	if funcDecl.Type.Params.NumFields() != 0 || funcDecl.Type.Results.NumFields() != 1 {
+		return nil, fmt.Errorf("defaults function %s must take no arguments and return a single value", name)
 	}
 
-	return fields, nil
+	// The fields set by the function are known when it returns a composite literal right away
+	def := &defaultValue{Ref: defaultsLocalVar, Call: name}
+	if funcDecl.Body != nil && len(funcDecl.Body.List) == 1 {
+		if ret, ok := funcDecl.Body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+			def.Lit = compositeLiteral(ret.Results[0])
+		}
+	}
+	return def, nil
 }
 
-func extractDefaults(node *ast.File, structName string) (map[string]string, error) {
-	defaults := make(map[string]string)
-	defaultVarName := "default" + strings.Title(structName)
-
-	ast.Inspect(node, func(n ast.Node) bool {
-		genDecl, ok := n.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.VAR {
+// referencesDefaults reports whether the registration of any of fields reads the result of the defaults function
+func referencesDefaults(fields []flagField) bool {
+	for _, field := range fields {
+		if !field.Skip && strings.HasPrefix(registeredDefaultRef(field.fieldInfo), defaultsLocalVar+".") {
 			return true
 		}
+	}
+	return false
+}
 
-		for _, spec := range genDecl.Specs {
-			valueSpec, ok := spec.(*ast.ValueSpec)
-			if !ok {
-				continue
+// findFunc returns the package-level function named name in files
+func findFunc(files []*ast.File, name string) *ast.FuncDecl {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Recv == nil && funcDecl.Name.Name == name {
+				return funcDecl
 			}
+		}
+	}
+	return nil
+}
 
-			for i, name := range valueSpec.Names {
-				if name.Name != defaultVarName {
-					continue
-				}
-				if i >= len(valueSpec.Values) {
-					continue
-				}
-
-				compositeLit, ok := valueSpec.Values[i].(*ast.CompositeLit)
-				if !ok {
+// findVar returns the first of names declared as a package-level variable in files, along with its value
+func findVar(files []*ast.File, names ...string) (string, ast.Expr) {
+	for _, name := range names {
+		for _, file := range files {
+			for _, decl := range file.Decls {
+				genDecl, ok := decl.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.VAR {
 					continue
 				}
-
-				for _, elt := range compositeLit.Elts {
-					kvExpr, ok := elt.(*ast.KeyValueExpr)
+				for _, spec := range genDecl.Specs {
+					valueSpec, ok := spec.(*ast.ValueSpec)
 					if !ok {
 						continue
 					}
-
-					keyIdent, ok := kvExpr.Key.(*ast.Ident)
-					if !ok {
-						continue
+					for i, ident := range valueSpec.Names {
+						if ident.Name == name && i < len(valueSpec.Values) {
+							return name, valueSpec.Values[i]
+						}
 					}
-
-					k, v := keyIdent.Name, defaultVarName+"."+keyIdent.Name
-					defaults[k] = v
 				}
 			}
 		}
-
-		return true
-	})
-
-	return defaults, nil
-}
-
-// extractImports extracts import paths from an AST file and returns a map of alias -> import path
-func extractImports(node *ast.File) map[string]string {
-	imports := make(map[string]string)
-	for _, imp := range node.Imports {
-		path := strings.Trim(imp.Path.Value, `"`)
-		var alias string
-		if imp.Name != nil {
-			alias = imp.Name.Name
-		} else {
-			// Use the last part of the import path as alias
-			parts := strings.Split(path, "/")
-			alias = parts[len(parts)-1]
-		}
-		imports[alias] = path
 	}
-	return imports
+	return "", nil
 }
 
-// resolvePackagePath resolves an import path to a filesystem directory using `go list`
-func resolvePackagePath(importPath string) (string, error) {
-	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", importPath)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to resolve package %s: %w", importPath, err)
+// literalKeys returns the values of the keyed elements of a composite literal
+func literalKeys(compositeLit *ast.CompositeLit) map[string]ast.Expr {
+	keys := make(map[string]ast.Expr)
+	for _, elt := range compositeLit.Elts {
+		kvExpr, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if keyIdent, ok := kvExpr.Key.(*ast.Ident); ok {
+			keys[keyIdent.Name] = kvExpr.Value
+		}
 	}
-	return strings.TrimSpace(string(output)), nil
+	return keys
 }
 
-// parseEmbeddedStruct parses an embedded struct from a package directory
-func parseEmbeddedStruct(pkgDir, structName string) ([]fieldInfo, error) {
-	fset := token.NewFileSet()
+// errEmbeddingCycle is returned for structs that embed themselves, directly or through other embedded structs
+var errEmbeddingCycle = errors.New("embedding cycle")
 
-	// Parse all Go files in the package directory
-	pkgs, err := parser.ParseDir(fset, pkgDir, func(fi os.FileInfo) bool {
-		return !strings.HasSuffix(fi.Name(), "_test.go")
-	}, parser.ParseComments)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse package directory %s: %w", pkgDir, err)
+// embeddedType describes the struct embedded by a field declared in pkg, or returns false if the field does not
+// embed a struct
+func embeddedType(resolver *typeResolver, pkg *packages.Package, field *ast.Field) (embeddedStructInfo, bool, error) {
+	if len(field.Names) != 0 {
+		return embeddedStructInfo{}, false, nil
 	}
 
-	var fields []fieldInfo
-	found := false
-
-	for _, pkg := range pkgs {
-		for _, file := range pkg.Files {
-			ast.Inspect(file, func(n ast.Node) bool {
-				typeSpec, ok := n.(*ast.TypeSpec)
-				if !ok || typeSpec.Name.Name != structName {
-					return true
-				}
-
-				structType, ok := typeSpec.Type.(*ast.StructType)
-				if !ok {
-					return true
-				}
+	var embedded embeddedStructInfo
+	t := types.Unalias(pkg.TypesInfo.TypeOf(field.Type))
+	if pointer, ok := t.(*types.Pointer); ok {
+		embedded.Pointer = true
+		t = types.Unalias(pointer.Elem())
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return embeddedStructInfo{}, false, nil
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return embeddedStructInfo{}, false, nil
+	}
 
-				found = true
-				for _, field := range structType.Fields.List {
-					if len(field.Names) == 0 {
-						// Skip embedded structs in embedded structs for now
-						continue
-					}
+	embedded.TypeName = named.Obj().Name()
+	if named.Obj().Pkg().Path() != resolver.root.PkgPath {
+		embedded.PkgAlias = resolver.packageName(named.Obj().Pkg())
+		embedded.PkgPath = named.Obj().Pkg().Path()
+	}
 
-					fieldName := field.Names[0].Name
-					fieldType := getTypeString(field.Type)
+	if field.Tag != nil {
+		tag, err := parseStructTag(field.Tag.Value)
+		if err != nil {
+			return embedded, false, fmt.Errorf("embedded %s: %w", embedded.TypeName, err)
+		}
+		embedded.Tag = tag
+	}
+	return embedded, true, nil
+}
 
-					// Check for pflags:"-" tag
-					skip := false
-					if field.Tag != nil {
-						tagValue := field.Tag.Value
-						if strings.Contains(tagValue, `pflags:"-"`) {
-							skip = true
-						}
-					}
+// parseEmbeddedStruct parses the fields of an embedded struct, along with the structs it embeds.
+// chain holds the embedded structs being parsed, outermost first, to detect embedding cycles.
+func parseEmbeddedStruct(resolver *typeResolver, info embeddedStructInfo, chain []string) (embeddedStructInfo, error) {
+	key := info.TypeName
+	if info.PkgPath != "" {
+		key = info.PkgPath + "." + info.TypeName
+	}
+	for _, outer := range chain {
+		if outer == key {
+			return info, fmt.Errorf("%w: %s -> %s, skip one of the embeds with `pflags:\"-\"`", errEmbeddingCycle, strings.Join(chain, " -> "), key)
+		}
+	}
+	chain = append(chain, key)
 
-					// Extract comment
-					comment := ""
-					if field.Doc != nil && len(field.Doc.List) > 0 {
-						comment = strings.TrimSpace(field.Doc.List[0].Text)
-						comment = strings.TrimPrefix(comment, "//")
-						comment = strings.TrimSpace(comment)
-						comment = strings.Trim(comment, `"`)
-					} else if field.Comment != nil && len(field.Comment.List) > 0 {
-						comment = strings.TrimSpace(field.Comment.List[0].Text)
-						comment = strings.TrimPrefix(comment, "//")
-						comment = strings.TrimSpace(comment)
-						comment = strings.Trim(comment, `"`)
-					}
+	pkg, err := resolver.loadPackage(info.PkgPath)
+	if err != nil {
+		return info, err
+	}
+	structType, err := structDecl(pkg, info.TypeName)
+	if err != nil {
+		return info, err
+	}
+	info.FilePath = pkg.Fset.Position(structType.Pos()).Filename
 
-					fields = append(fields, fieldInfo{
-						Name:    fieldName,
-						Type:    fieldType,
-						Comment: comment,
-						Skip:    skip,
-					})
+	for _, field := range structType.Fields.List {
+		// Embedded structs in embedded structs: either from the same package or an imported one
+		inner, ok, err := embeddedType(resolver, pkg, field)
+		if err != nil {
+			return info, fmt.Errorf("struct %s: %w", info.TypeName, err)
+		}
+		if ok {
+			if info.PkgPath != "" && !ast.IsExported(inner.TypeName) {
+				continue
+			}
+			// Skipped embeds become parameters of load<Struct>, their structs are not walked
+			if !inner.Tag.Skip {
+				if inner, err = parseEmbeddedStruct(resolver, inner, chain); err != nil {
+					return info, err
 				}
-
-				return false
-			})
-			if found {
-				break
 			}
+			info.Embedded = append(info.Embedded, inner)
+			continue
 		}
-		if found {
-			break
-		}
-	}
 
-	if !found {
-		return nil, fmt.Errorf("struct %s not found in package %s", structName, pkgDir)
+		// Only exported fields of structs from other packages can be set
+		if len(field.Names) == 0 || (info.PkgPath != "" && !ast.IsExported(field.Names[0].Name)) {
+			continue
+		}
+		fieldInfo, err := resolver.newField(pkg, field)
+		if err != nil {
+			return info, fmt.Errorf("struct %s: %w", info.TypeName, err)
+		}
+		info.Fields = append(info.Fields, fieldInfo)
 	}
 
-	return fields, nil
+	return info, nil
 }
 
 // extractEmbeddedStructs finds embedded structs in the main struct and parses their fields
-func extractEmbeddedStructs(node *ast.File, structName, sourceFilePath string) ([]embeddedStructInfo, error) {
-	var embeddedStructs []embeddedStructInfo
-	imports := extractImports(node)
+func extractEmbeddedStructs(resolver *typeResolver, structName string) ([]embeddedStructInfo, error) {
+	structType, err := structDecl(resolver.root, structName)
+	if err != nil {
+		return nil, err
+	}
 
-	ast.Inspect(node, func(n ast.Node) bool {
-		typeSpec, ok := n.(*ast.TypeSpec)
-		if !ok || typeSpec.Name.Name != structName {
-			return true
+	var embeddedStructs []embeddedStructInfo
+	for _, field := range structType.Fields.List {
+		// Embedded struct has no names: T, *T, pkg.T or *pkg.T
+		embedded, ok, err := embeddedType(resolver, resolver.root, field)
+		if err != nil {
+			return nil, err
 		}
-
-		structType, ok := typeSpec.Type.(*ast.StructType)
 		if !ok {
-			return true
+			continue
 		}
 
-		for _, field := range structType.Fields.List {
-			// Embedded struct has no names
-			if len(field.Names) != 0 {
-				continue
-			}
-
-			// Check if it's a selector expression (pkg.Type)
-			selectorExpr, ok := field.Type.(*ast.SelectorExpr)
-			if !ok {
-				continue
-			}
-
-			pkgIdent, ok := selectorExpr.X.(*ast.Ident)
-			if !ok {
-				continue
-			}
-
-			pkgAlias := pkgIdent.Name
-			typeName := selectorExpr.Sel.Name
-			pkgPath, ok := imports[pkgAlias]
-			if !ok {
-				log.Printf("warning: could not find import for package alias %s", pkgAlias)
-				continue
-			}
-
-			// Resolve the package path to a filesystem directory
-			pkgDir, err := resolvePackagePath(pkgPath)
-			if err != nil {
-				log.Printf("warning: %v", err)
-				continue
-			}
-
-			// Parse the embedded struct
-			fields, err := parseEmbeddedStruct(pkgDir, typeName)
-			if err != nil {
-				log.Printf("warning: %v", err)
-				continue
+		// Parse the embedded struct and the structs it embeds, unless it is skipped and passed to load<Struct>
+		if !embedded.Tag.Skip {
+			if embedded, err = parseEmbeddedStruct(resolver, embedded, nil); err != nil {
+				return nil, err
 			}
-
-			embeddedStructs = append(embeddedStructs, embeddedStructInfo{
-				TypeName: typeName,
-				PkgAlias: pkgAlias,
-				PkgPath:  pkgPath,
-				Fields:   fields,
-				FilePath: filepath.Join(pkgDir, "*.go"),
-			})
 		}
-
-		return false
-	})
-
+		embeddedStructs = append(embeddedStructs, embedded)
+	}
 	return embeddedStructs, nil
 }
 
-func getTypeString(expr ast.Expr) string {
-	switch t := expr.(type) {
-	case *ast.Ident:
-		return t.Name
-	case *ast.SelectorExpr:
-		return fmt.Sprintf("%s.%s", getTypeString(t.X), t.Sel.Name)
-	case *ast.ArrayType:
-		return "[]" + getTypeString(t.Elt)
-	case *ast.StarExpr:
-		return "*" + getTypeString(t.X)
-	default:
-		return "unknown"
+// flattenEmbedded lists embedded structs and the structs they embed, outermost first
+func flattenEmbedded(embeddedStructs []embeddedStructInfo) []*embeddedStructInfo {
+	var out []*embeddedStructInfo
+	for i := range embeddedStructs {
+		out = append(out, &embeddedStructs[i])
+		out = append(out, flattenEmbedded(embeddedStructs[i].Embedded)...)
 	}
+	return out
 }
 
 func getValueString(expr ast.Expr) string {
@@ -463,33 +640,103 @@ func getValueString(expr ast.Expr) string {
 	}
 }
 
+// camelToKebab converts a camelCase name to kebab-case, keeping acronyms together:
+// httpPort -> http-port, HTTPPort -> http-port, userID -> user-id, userIDs -> user-ids
 func camelToKebab(s string) string {
+	runes := []rune(s)
 	var result []rune
-	for i, r := range s {
+	for i, r := range runes {
 		if i > 0 && unicode.IsUpper(r) {
-			result = append(result, '-')
+			prev := runes[i-1]
+			// Start of a new word: after a lowercase letter or digit, or the last capital of an acronym
+			// that is followed by a lowercase letter (the "P" in "HTTPPort"), unless that letter is
+			// the plural "s" of the acronym ("URLs", "userIDs")
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if nextIsLower && runes[i+1] == 's' && (i+2 == len(runes) || !unicode.IsLower(runes[i+2])) {
+				nextIsLower = false
+			}
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				result = append(result, '-')
+			}
 		}
 		result = append(result, unicode.ToLower(r))
 	}
 	return string(result)
 }
 
+// hasPflagType reports whether pflag has a dedicated flag type for the Go type
+func hasPflagType(goType string) bool {
+	return goType == "string" || getPflagType(goType) != "String"
+}
+
 func getPflagType(goType string) string {
 	switch goType {
 	case "string":
 		return "String"
 	case "bool":
 		return "Bool"
-	case "int", "int32", "int64":
+	case "int":
 		return "Int"
-	case "uint", "uint32", "uint64":
+	case "int8":
+		return "Int8"
+	case "int16":
+		return "Int16"
+	case "int32":
+		return "Int32"
+	case "int64":
+		return "Int64"
+	case "uint":
 		return "Uint"
-	case "float32", "float64":
+	case "uint8":
+		return "Uint8"
+	case "uint16":
+		return "Uint16"
+	case "uint32":
+		return "Uint32"
+	case "uint64":
+		return "Uint64"
+	case "float32":
+		return "Float32"
+	case "float64":
 		return "Float64"
 	case "[]string":
 		return "StringSlice"
+	case "[]int":
+		return "IntSlice"
+	case "[]int32":
+		return "Int32Slice"
+	case "[]int64":
+		return "Int64Slice"
+	case "[]uint":
+		return "UintSlice"
+	case "[]bool":
+		return "BoolSlice"
+	case "[]float32":
+		return "Float32Slice"
+	case "[]float64":
+		return "Float64Slice"
+	case "map[string]string":
+		return "StringToString"
+	case "map[string]int":
+		return "StringToInt"
+	case "map[string]int64":
+		return "StringToInt64"
+	case "net.IP":
+		return "IP"
+	case "[]net.IP":
+		return "IPSlice"
+	case "net.IPNet":
+		return "IPNet"
+	case "[]net.IPNet":
+		return "IPNetSlice"
+	case "net.IPMask":
+		return "IPMask"
+	case "[]byte":
+		return "BytesHex"
 	case "time.Duration":
 		return "Duration"
+	case "[]time.Duration":
+		return "DurationSlice"
 	default:
 		return "String"
 	}
@@ -501,21 +748,204 @@ func getFlagGetterType(goType string) string {
 		return "GetString"
 	case "bool":
 		return "GetBool"
-	case "int", "int32", "int64":
+	case "int":
 		return "GetInt"
-	case "uint", "uint32", "uint64":
+	case "int8":
+		return "GetInt8"
+	case "int16":
+		return "GetInt16"
+	case "int32":
+		return "GetInt32"
+	case "int64":
+		return "GetInt64"
+	case "uint":
 		return "GetUint"
-	case "float32", "float64":
+	case "uint8":
+		return "GetUint8"
+	case "uint16":
+		return "GetUint16"
+	case "uint32":
+		return "GetUint32"
+	case "uint64":
+		return "GetUint64"
+	case "float32":
+		return "GetFloat32"
+	case "float64":
 		return "GetFloat64"
 	case "[]string":
 		return "GetStringSlice"
+	case "[]int":
+		return "GetIntSlice"
+	case "[]int32":
+		return "GetInt32Slice"
+	case "[]int64":
+		return "GetInt64Slice"
+	case "[]uint":
+		return "GetUintSlice"
+	case "[]bool":
+		return "GetBoolSlice"
+	case "[]float32":
+		return "GetFloat32Slice"
+	case "[]float64":
+		return "GetFloat64Slice"
+	case "map[string]string":
+		return "GetStringToString"
+	case "map[string]int":
+		return "GetStringToInt"
+	case "map[string]int64":
+		return "GetStringToInt64"
+	case "net.IP":
+		return "GetIP"
+	case "[]net.IP":
+		return "GetIPSlice"
+	case "net.IPNet":
+		return "GetIPNet"
+	case "[]net.IPNet":
+		return "GetIPNetSlice"
+	case "net.IPMask":
+		return "GetIPv4Mask"
+	case "[]byte":
+		return "GetBytesHex"
 	case "time.Duration":
 		return "GetDuration"
+	case "[]time.Duration":
+		return "GetDurationSlice"
 	default:
 		return "GetString"
 	}
 }
 
+// fieldGoType returns the Go type of the field as declared in the struct
+func fieldGoType(field fieldInfo) string {
+	if field.Pointer {
+		return "*" + field.Type
+	}
+	return field.Type
+}
+
+// flagGoType returns the Go type of the value the field's flag holds
+func flagGoType(field fieldInfo) string {
+	if field.UnderlyingType != "" {
+		return field.UnderlyingType
+	}
+	return field.Type
+}
+
+// fieldDefaultValue returns the default value expression passed when registering the field's flag
+func fieldDefaultValue(field fieldInfo) string {
+	if field.DefaultValueRef == "" {
+		return formatDefaultValue(flagGoType(field), field.DefaultValue)
+	}
+	if field.UnderlyingType != "" {
+		// Convert the named type to the type the flag holds
+		return fmt.Sprintf("%s(%s)", field.UnderlyingType, field.DefaultValueRef)
+	}
+	return field.DefaultValueRef
+}
+
+// fieldPflagType returns the pflag registration function for a field, honouring its tag overrides
+func fieldPflagType(field fieldInfo) string {
+	if namedEnum(field) {
+		return "String"
+	}
+	if field.Tag.Array && flagGoType(field) == "[]string" {
+		return "StringArray"
+	}
+	if field.Tag.Encoding == "base64" && flagGoType(field) == "[]byte" {
+		return "BytesBase64"
+	}
+	return getPflagType(flagGoType(field))
+}
+
+// fieldGetterType returns the pflag getter for a field, honouring its tag overrides
+func fieldGetterType(field fieldInfo) string {
+	if namedEnum(field) {
+		return "GetString"
+	}
+	if countFlag(field) {
+		return "GetCount"
+	}
+	if field.Tag.Array && flagGoType(field) == "[]string" {
+		return "GetStringArray"
+	}
+	if field.Tag.Encoding == "base64" && flagGoType(field) == "[]byte" {
+		return "GetBytesBase64"
+	}
+	return getFlagGetterType(flagGoType(field))
+}
+
+// usageHint returns a note appended to the flag usage that explains the value syntax for the Go type
+func usageHint(goType string) string {
+	if strings.HasPrefix(goType, "map[string]") {
+		return "format: k=v,k2=v2"
+	}
+	return ""
+}
+
+// enumChoices returns the allowed values of an enum field as shown to the user
+func enumChoices(field fieldInfo) string {
+	choices := make([]string, len(field.EnumValues))
+	for i, value := range field.EnumValues {
+		if namedEnum(field) {
+			value = enumFlagValue(field, field.EnumNames[i])
+		} else if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		choices[i] = value
+	}
+	return strings.Join(choices, ", ")
+}
+
+// namedEnum reports whether a field is an enum of non-string constants, e.g. `type mode int`. Its flag takes
+// values derived from the constant names, as the constant values mean nothing on the command line.
+func namedEnum(field fieldInfo) bool {
+	return len(field.EnumValues) > 0 && flagGoType(field) != "string"
+}
+
+// enumFlagValue returns the flag value of a namedEnum constant: its name without the package qualifier and the
+// name of its type, in kebab-case, e.g. fast for modeFast of type mode or http2 for ProtocolHTTP2 of type Protocol
+func enumFlagValue(field fieldInfo, name string) string {
+	name = name[strings.LastIndex(name, ".")+1:]
+	typeName := field.Type[strings.LastIndex(field.Type, ".")+1:]
+	if len(name) > len(typeName) && strings.EqualFold(name[:len(typeName)], typeName) {
+		if rest := name[len(typeName):]; !unicode.IsLower(rune(rest[0])) {
+			name = rest
+		}
+	}
+	return camelToKebab(name)
+}
+
+// enumZeroName returns the flag value of the enum constant equal to the zero value, or "" if there is none
+func enumZeroName(field fieldInfo) string {
+	for i, value := range field.EnumValues {
+		if value == "0" || value == "false" {
+			return enumFlagValue(field, field.EnumNames[i])
+		}
+	}
+	return ""
+}
+
+// fieldUsage appends the value syntax hint, if any, to the field usage
+func fieldUsage(field fieldInfo, usage string) string {
+	hint := usageHint(flagGoType(field))
+	if flagGoType(field) == "[]byte" {
+		hint = "hex encoded"
+		if field.Tag.Encoding == "base64" {
+			hint = "base64 encoded"
+		}
+	}
+	if len(field.EnumValues) > 0 {
+		hint = "one of: " + enumChoices(field)
+	}
+	if hint == "" {
+		return usage
+	}
+	if usage == "" {
+		return hint
+	}
+	return usage + " (" + hint + ")"
+}
+
 func formatDefaultValue(goType, value string) string {
 	if value == "" {
 		switch goType {
@@ -523,12 +953,19 @@ func formatDefaultValue(goType, value string) string {
 			return `""`
 		case "bool":
 			return "false"
-		case "int", "int32", "int64", "uint", "uint32", "uint64":
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "time.Duration":
 			return "0"
 		case "float32", "float64":
 			return "0.0"
-		case "[]string":
+		case "[]string", "[]byte", "[]int", "[]int32", "[]int64", "[]uint", "[]bool", "[]float32", "[]float64", "[]time.Duration",
+			"map[string]string", "map[string]int", "map[string]int64",
+			"net.IP", "[]net.IP", "[]net.IPNet":
 			return "nil"
+		case "net.IPMask":
+			// pflag cannot read back a nil mask, so default to an all-zero one
+			return "net.IPv4Mask(0, 0, 0, 0)"
+		case "net.IPNet":
+			return "net.IPNet{}"
 		default:
 			return `""`
 		}
@@ -537,223 +974,768 @@ func formatDefaultValue(goType, value string) string {
 	switch goType {
 	case "string":
 		return fmt.Sprintf(`"%s"`, value)
-	case "bool", "int", "int32", "int64", "uint", "uint32", "uint64", "float32", "float64":
+	case "bool", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
 		return value
 	default:
 		return fmt.Sprintf(`"%s"`, value)
 	}
 }
 
-// embeddedFieldFlagName generates the flag constant name for an embedded field
-// Example: EnableFeature from FeatureDefaults -> flagFeatureEnableFeatureDefaultValue
-func embeddedFieldFlagName(embeddedTypeName, fieldName string) string {
-	// Remove common suffixes to create a prefix
+// embeddedTypePrefix removes common suffixes from an embedded type name to prefix its flags with
+// Example: FeatureDefaults -> Feature
+func embeddedTypePrefix(embeddedTypeName string) string {
 	prefix := embeddedTypeName
 	prefix = strings.TrimSuffix(prefix, "Defaults")
 	prefix = strings.TrimSuffix(prefix, "Options")
 	prefix = strings.TrimSuffix(prefix, "Config")
+	return prefix
+}
 
-	return "flag" + prefix + strings.Title(fieldName) + "DefaultValue"
+// embeddedFieldFlagName generates the flag constant name for a field of an untagged embedded struct
+// Example: EnableFeature from FeatureDefaults -> flagFeatureEnableFeatureDefaultValue
+func embeddedFieldFlagName(embeddedTypeName string, field flagField) string {
+	return "flag" + identConstName(embeddedTypePrefix(embeddedTypeName)) + strings.TrimPrefix(field.ConstName, "flag") + "DefaultValue"
 }
 
-// embeddedFieldKebabName generates the kebab-case flag name for an embedded field
-func embeddedFieldKebabName(embeddedTypeName, fieldName string) string {
-	prefix := embeddedTypeName
-	prefix = strings.TrimSuffix(prefix, "Defaults")
-	prefix = strings.TrimSuffix(prefix, "Options")
-	prefix = strings.TrimSuffix(prefix, "Config")
+// embeddedFieldKebabName generates the kebab-case flag name for a field of an untagged embedded struct
+// Example: EnableFeature from FeatureDefaults -> feature-enable-feature-default-value
+func embeddedFieldKebabName(embeddedTypeName string, field flagField) string {
+	return camelToKebab(embeddedTypePrefix(embeddedTypeName)) + "-" + field.FlagName + "-default-value"
+}
 
-	return camelToKebab(prefix) + "-" + camelToKebab(fieldName) + "-default-value"
+// embeddedLocalName generates the load<Struct> name of an embedded struct from its embedding path, which its
+// fields are prefixed with: tlsOptions for a TLSOptions embed, serverOptionsTLSOptions for a TLSOptions embed
+// in a ServerOptions embed
+func embeddedLocalName(parentLocalName, embeddedTypeName string) string {
+	if parentLocalName == "" {
+		return kebabToCamel(camelToKebab(embeddedTypeName))
+	}
+	return parentLocalName + strings.Title(embeddedTypeName)
 }
 
-// lowerFirst converts the first character of a string to lowercase
-func lowerFirst(s string) string {
-	if len(s) == 0 {
-		return s
+// kebabToCamel converts a kebab-case name to lower camelCase, e.g. tls-options -> tlsOptions
+func kebabToCamel(s string) string {
+	parts := strings.Split(s, "-")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.Title(parts[i])
 	}
-	return strings.ToLower(s[:1]) + s[1:]
+	return strings.Join(parts, "")
 }
 
-func generatePflagsCode(fields []fieldInfo, embeddedStructs []embeddedStructInfo, structName, packageName string) string {
-	structNameC := strings.Title(structName)
+// kebabToConstName converts a kebab-case name to the words it adds to flag constant names, spelling initialisms
+// the way Go names do: tls -> TLS, http-server -> HTTPServer, user-ids -> UserIDs, db -> Db. Every part of a flag
+// constant name, from flag name prefixes as well as field and type names, is spelled this way.
+func kebabToConstName(name string) string {
+	var constName strings.Builder
+	for _, word := range strings.Split(name, "-") {
+		upper := strings.ToUpper(word)
+		switch {
+		case commonInitialisms[upper]:
+			constName.WriteString(upper)
+		case strings.HasSuffix(word, "s") && commonInitialisms[strings.TrimSuffix(upper, "S")]:
+			// Plural initialisms keep a lowercase s, e.g. IDs
+			constName.WriteString(strings.TrimSuffix(upper, "S") + "s")
+		default:
+			constName.WriteString(strings.Title(word))
+		}
+	}
+	return constName.String()
+}
 
-	var buf bytes.Buffer
+// identConstName converts a Go identifier to the words it adds to flag constant names, e.g. httpPort -> HTTPPort
+func identConstName(ident string) string {
+	return kebabToConstName(camelToKebab(ident))
+}
 
-	// Add "// Code generated by struct-to-pflags; DO NOT EDIT." comment
-	buf.WriteString("// Code generated by struct-to-pflags; DO NOT EDIT.\n\n")
+// commonInitialisms are the initialisms Go names spell in one case, as listed by golint
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true, "GUID": true,
+	"HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true, "LHS": true, "QPS": true,
+	"RAM": true, "RHS": true, "RPC": true, "SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true,
+	"TLS": true, "TTL": true, "UDP": true, "UI": true, "UID": true, "UUID": true, "URI": true, "URL": true,
+	"UTF8": true, "VM": true, "XML": true, "XMPP": true, "XSRF": true, "XSS": true,
+}
 
-	// Add package statement
-	buf.WriteString(fmt.Sprintf("package %s\n\n", packageName))
+// textFlagTypes are field types registered through pflag's TextVar, as they implement
+// encoding.TextMarshaler and encoding.TextUnmarshaler but have no dedicated pflag type
+var textFlagTypes = map[string]bool{
+	"netip.Addr":     true,
+	"netip.Prefix":   true,
+	"netip.AddrPort": true,
+}
 
-	// Determine required imports
-	needsTime := false
-	for _, field := range fields {
-		if field.Type == "time.Duration" {
-			needsTime = true
-			break
+// importGuards holds expressions that keep an import used when no generated code references it
+var importGuards = map[string]string{
+	"time": "time.Second",
+	"net":  "net.IPv4len",
+}
+
+// importSpec is a single import of the generated file
+type importSpec struct {
+	Alias string
+	Path  string
+}
+
+func (s importSpec) String() string {
+	if s.Alias == "" || s.Alias == path.Base(s.Path) {
+		return fmt.Sprintf("%q", s.Path)
+	}
+	return fmt.Sprintf("%s %q", s.Alias, s.Path)
+}
+
+// requiredImports returns the sorted standard library and third-party imports of the generated code
+func requiredImports(structs []structFlags) ([]importSpec, []importSpec) {
+	seen := map[importSpec]bool{{Path: "github.com/spf13/pflag"}: true}
+	collect := func(fields []fieldInfo, cobra bool) {
+		walkFields(fields, func(field fieldInfo) {
+			for alias, importPath := range field.Imports {
+				seen[importSpec{Alias: alias, Path: importPath}] = true
+			}
+			if field.ValueKind == valueKindPflag || len(field.EnumValues) > 0 {
+				seen[importSpec{Path: "fmt"}] = true
+			}
+			if !field.Skip && countFlag(field) && registeredDefaultRef(field) != "" {
+				seen[importSpec{Path: "strconv"}] = true
+			}
+			if !field.Skip && field.Tag.Required {
+				seen[importSpec{Path: "fmt"}] = true
+				seen[importSpec{Path: "strings"}] = true
+				if cobra {
+					seen[importSpec{Path: "github.com/spf13/cobra"}] = true
+				}
+			}
+		})
+	}
+	for _, s := range structs {
+		collect(s.Fields, s.Cobra)
+		for _, embedded := range flattenEmbedded(s.Embedded) {
+			if embedded.PkgPath != "" {
+				seen[importSpec{Alias: embedded.PkgAlias, Path: embedded.PkgPath}] = true
+			}
+			collect(embedded.Fields, s.Cobra)
+		}
+	}
+
+	var std, other []importSpec
+	for spec := range seen {
+		if strings.Contains(strings.Split(spec.Path, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
 		}
 	}
-	if !needsTime {
-		for _, embedded := range embeddedStructs {
-			for _, field := range embedded.Fields {
-				if field.Type == "time.Duration" {
-					needsTime = true
-					break
+	sort.Slice(std, func(i, j int) bool { return std[i].Path < std[j].Path })
+	sort.Slice(other, func(i, j int) bool { return other[i].Path < other[j].Path })
+	return std, other
+}
+
+// registeredDefaultRef returns the default reference the registration of a field's flag reads, or "" if it
+// registers the flag without one
+func registeredDefaultRef(field fieldInfo) string {
+	if field.Pointer {
+		// Optional fields are nil by default, so their flags default to the zero value
+		return ""
+	}
+	return field.DefaultValueRef
+}
+
+// writeFlagRegistration writes the statements registering a field's flag in with<Struct>Flags
+func writeFlagRegistration(buf *bytes.Buffer, field fieldInfo, localVar, flagConst, usage string, cobra bool) {
+	field.DefaultValueRef = registeredDefaultRef(field)
+
+	// Flags with a shorthand are registered through the P variant of the function
+	suffix, shorthand := "", ""
+	if field.Tag.Short != "" {
+		suffix, shorthand = "P", fmt.Sprintf(" %q,", field.Tag.Short)
+	}
+
+	switch field.ValueKind {
+	case valueKindPflag:
+		valueVar := localVar + "Value"
+		if field.DefaultValueRef != "" {
+			buf.WriteString(fmt.Sprintf("\t%s := %s\n", valueVar, field.DefaultValueRef))
+		} else {
+			buf.WriteString(fmt.Sprintf("\tvar %s %s\n", valueVar, field.Type))
+		}
+		buf.WriteString(fmt.Sprintf("\tflags.Var%s(&%s, %s,%s %q)\n", suffix, valueVar, flagConst, shorthand, usage))
+	case valueKindText:
+		defaultPtr := fmt.Sprintf("new(%s)", field.Type)
+		if field.DefaultValueRef != "" {
+			defaultPtr = "&" + field.DefaultValueRef
+		}
+		buf.WriteString(fmt.Sprintf("\tflags.TextVar%s(new(%s), %s,%s %s, %q)\n",
+			suffix, field.Type, flagConst, shorthand, defaultPtr, usage))
+	default:
+		if namedEnum(field) {
+			// The flag holds the name of the default constant
+			defaultValue := strconv.Quote(enumZeroName(field))
+			if field.DefaultValueRef != "" {
+				defaultValue = localVar + "Default"
+				buf.WriteString(fmt.Sprintf("\tvar %s string\n", defaultValue))
+				buf.WriteString(fmt.Sprintf("\tswitch %s {\n", field.DefaultValueRef))
+				for _, name := range field.EnumNames {
+					buf.WriteString(fmt.Sprintf("\tcase %s:\n", name))
+					buf.WriteString(fmt.Sprintf("\t\t%s = %q\n", defaultValue, enumFlagValue(field, name)))
 				}
+				buf.WriteString("\t}\n")
 			}
-			if needsTime {
-				break
+			buf.WriteString(fmt.Sprintf("\tflags.String%s(%s,%s %s, %q)\n", suffix, flagConst, shorthand, defaultValue, usage))
+			break
+		}
+		if countFlag(field) {
+			// Counters are incremented by each -v, so -vvv yields 3. CountP takes no default, the count starts
+			// from it instead.
+			buf.WriteString(fmt.Sprintf("\tflags.CountP(%s, %q, %q)\n", flagConst, countShorthand(field), usage))
+			if field.DefaultValueRef != "" {
+				flagVar := localVar + "Flag"
+				buf.WriteString(fmt.Sprintf("\t%s := flags.Lookup(%s)\n", flagVar, flagConst))
+				buf.WriteString(fmt.Sprintf("\t_ = %s.Value.Set(strconv.Itoa(%s))\n", flagVar, fieldDefaultValue(field)))
+				buf.WriteString(fmt.Sprintf("\t%s.DefValue = %s.Value.String()\n", flagVar, flagVar))
 			}
+			break
 		}
+		buf.WriteString(fmt.Sprintf("\tflags.%s%s(%s,%s %s, %q)\n",
+			fieldPflagType(field), suffix, flagConst, shorthand, fieldDefaultValue(field), usage))
 	}
 
-	// Add imports
-	buf.WriteString("import (\n")
-	if needsTime {
-		buf.WriteString("\t\"time\"\n\n")
+	if field.Tag.Hidden {
+		buf.WriteString(fmt.Sprintf("\t_ = flags.MarkHidden(%s)\n", flagConst))
 	}
-	buf.WriteString("\t\"github.com/spf13/pflag\"\n")
-	for _, embedded := range embeddedStructs {
-		buf.WriteString(fmt.Sprintf("\n\t\"%s\"\n", embedded.PkgPath))
+	if field.Tag.Deprecated != "" {
+		buf.WriteString(fmt.Sprintf("\t_ = flags.MarkDeprecated(%s, %q)\n", flagConst, field.Tag.Deprecated))
 	}
-	buf.WriteString(")\n\n")
+	if field.Tag.Required && cobra {
+		// Lets cobra show the flag as required in help and shell completion
+		buf.WriteString(fmt.Sprintf("\t_ = cobra.MarkFlagRequired(flags, %s)\n", flagConst))
+	}
+}
 
-	// Generate flag constant names
-	buf.WriteString("const (\n")
-	for _, field := range fields {
+// countFlag reports whether a field is registered as a counter
+func countFlag(field fieldInfo) bool {
+	return field.Tag.Count && flagGoType(field) == "int" && !namedEnum(field)
+}
+
+// fieldShorthand returns the shorthand letter of a field's flag, or "" if it has none
+func fieldShorthand(field fieldInfo) string {
+	if countFlag(field) {
+		return countShorthand(field)
+	}
+	return field.Tag.Short
+}
+
+// checkFlagNames reports flag names, flag constants and shorthands used by more than one field of the structs and
+// their embedded structs, e.g. an inline embedded field named like a field of the struct, or two structs generated
+// together sharing a flag. Structs generated together may register their flags on the same flag set, so their
+// shorthands must not clash either. Within a struct, the load<Struct> variables of the fields, skipped ones
+// included, must differ too.
+func checkFlagNames(structs []structFlags) error {
+	flagOwners := make(map[string]string)
+	constOwners := make(map[string]string)
+	shorthandOwners := make(map[string]string)
+	var localOwners map[string]string
+	check := func(field flagField, owner string) error {
+		if other, ok := localOwners[field.LocalVar]; ok {
+			return fmt.Errorf("load variable %s is used for both %s and %s", field.LocalVar, other, owner)
+		}
+		localOwners[field.LocalVar] = owner
 		if field.Skip {
-			continue
+			return nil
 		}
-		flagName := camelToKebab(field.Name)
-		constName := "flag" + strings.Title(field.Name)
-		buf.WriteString(fmt.Sprintf("\t%s = \"%s\"\n", constName, flagName))
-	}
-	// Generate flag constants for embedded struct fields
-	for _, embedded := range embeddedStructs {
-		buf.WriteString(fmt.Sprintf("\n\t// %s flags\n", embedded.TypeName))
-		for _, field := range embedded.Fields {
-			if field.Skip {
-				continue
+		if other, ok := flagOwners[field.FlagName]; ok {
+			return fmt.Errorf("flag --%s is used by both %s and %s", field.FlagName, other, owner)
+		}
+		flagOwners[field.FlagName] = owner
+		if other, ok := constOwners[field.ConstName]; ok {
+			return fmt.Errorf("flag constant %s is generated for both %s and %s", field.ConstName, other, owner)
+		}
+		constOwners[field.ConstName] = owner
+		if shorthand := fieldShorthand(field.fieldInfo); shorthand != "" {
+			if other, ok := shorthandOwners[shorthand]; ok {
+				return fmt.Errorf("shorthand -%s is used by both %s and %s", shorthand, other, owner)
 			}
-			constName := embeddedFieldFlagName(embedded.TypeName, field.Name)
-			flagName := embeddedFieldKebabName(embedded.TypeName, field.Name)
-			buf.WriteString(fmt.Sprintf("\t%s = \"%s\"\n", constName, flagName))
+			shorthandOwners[shorthand] = owner
 		}
+		return nil
 	}
-	buf.WriteString(")\n\n")
 
-	// Generate withFlags function
-	buf.WriteString("func with" + structNameC + "Flags(flags *pflag.FlagSet) {\n")
-	for _, field := range fields {
-		if field.Skip {
-			continue
+	for _, s := range structs {
+		// Owners are qualified with the struct name only when it tells them apart
+		var structPrefix string
+		if len(structs) > 1 {
+			structPrefix = s.Name + "."
 		}
-		flagConst := "flag" + strings.Title(field.Name)
-		pflagType := getPflagType(field.Type)
-		comment := field.Comment
+		localOwners = make(map[string]string)
+		for _, field := range s.flagFields() {
+			if err := check(field, structPrefix+strings.TrimPrefix(field.Group+"."+field.Name, ".")); err != nil {
+				return err
+			}
+		}
+		for _, field := range s.embeddedFlagFields() {
+			if err := check(field, structPrefix+strings.TrimPrefix(field.Group+"."+field.Name, ".")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-		defaultVal := formatDefaultValue(field.Type, field.DefaultValue)
-		if field.DefaultValueRef != "" {
-			defaultVal = field.DefaultValueRef
+// countShorthand returns the shorthand of a counter flag: the tagged one or the first letter of its name,
+// e.g. -v for verbose
+func countShorthand(field fieldInfo) string {
+	if field.Tag.Short != "" {
+		return field.Tag.Short
+	}
+	return strings.ToLower(field.Name[:1])
+}
+
+// writeFlagGetter writes the statements reading a field's flag into localVar in load<Struct>
+func writeFlagGetter(buf *bytes.Buffer, field fieldInfo, localVar, flagConst string) {
+	if field.Pointer {
+		// Optional fields stay nil unless the flag was set explicitly
+		valueVar := localVar + "Value"
+		buf.WriteString(fmt.Sprintf("\tvar %s *%s\n", localVar, field.Type))
+		buf.WriteString(fmt.Sprintf("\tif flags.Changed(%s) {\n", flagConst))
+		writeFlagValueGetter(buf, field, valueVar, flagConst)
+		buf.WriteString(fmt.Sprintf("\t%s = &%s\n", localVar, valueVar))
+		buf.WriteString("\t}\n\n")
+		return
+	}
+
+	writeFlagValueGetter(buf, field, localVar, flagConst)
+	buf.WriteString("\n")
+}
+
+// writeFlagValueGetter writes the statements declaring localVar with the value of a field's flag
+func writeFlagValueGetter(buf *bytes.Buffer, field fieldInfo, localVar, flagConst string) {
+	switch field.ValueKind {
+	case valueKindPflag:
+		flagVar := localVar + "Flag"
+		valueVar := localVar + "Value"
+		buf.WriteString(fmt.Sprintf("\t%s := flags.Lookup(%s)\n", flagVar, flagConst))
+		buf.WriteString(fmt.Sprintf("\tif %s == nil {\n", flagVar))
+		buf.WriteString(fmt.Sprintf("\t\treturn nil, fmt.Errorf(\"flag accessed but not defined: %%s\", %s)\n", flagConst))
+		buf.WriteString("\t}\n")
+		buf.WriteString(fmt.Sprintf("\t%s, ok := %s.Value.(*%s)\n", valueVar, flagVar, field.Type))
+		buf.WriteString("\tif !ok {\n")
+		buf.WriteString(fmt.Sprintf("\t\treturn nil, fmt.Errorf(\"trying to get %s value of flag of type %%s\", %s.Value.Type())\n", field.Type, flagVar))
+		buf.WriteString("\t}\n")
+		buf.WriteString(fmt.Sprintf("\t%s := *%s\n", localVar, valueVar))
+	case valueKindText:
+		buf.WriteString(fmt.Sprintf("\tvar %s %s\n", localVar, field.Type))
+		buf.WriteString(fmt.Sprintf("\tif err := flags.GetText(%s, &%s); err != nil {\n", flagConst, localVar))
+		buf.WriteString("\t\treturn nil, err\n")
+		buf.WriteString("\t}\n")
+	default:
+		if namedEnum(field) {
+			writeEnumNameGetter(buf, field, localVar, flagConst)
+			return
 		}
+		valueVar := localVar
+		if field.UnderlyingType != "" {
+			valueVar = localVar + "Value"
+		}
+		if pflagType := fieldPflagType(field); pflagType == "IP" || pflagType == "IPNet" {
+			// pflag prints an unset net.IP or net.IPNet as "<nil>", which its getters cannot parse back,
+			// so such a flag keeps the zero value
+			flagVar := localVar + "Flag"
+			buf.WriteString(fmt.Sprintf("\tvar %s %s\n", valueVar, flagGoType(field)))
+			buf.WriteString(fmt.Sprintf("\tif %s := flags.Lookup(%s); %s == nil || %s.Value.String() != \"<nil>\" {\n", flagVar, flagConst, flagVar, flagVar))
+			buf.WriteString("\t\tvar err error\n")
+			buf.WriteString(fmt.Sprintf("\t\t%s, err = flags.%s(%s)\n", valueVar, fieldGetterType(field), flagConst))
+			buf.WriteString("\t\tif err != nil {\n")
+			buf.WriteString("\t\t\treturn nil, err\n")
+			buf.WriteString("\t\t}\n")
+			buf.WriteString("\t}\n")
+		} else {
+			buf.WriteString(fmt.Sprintf("\t%s, err := flags.%s(%s)\n", valueVar, fieldGetterType(field), flagConst))
+			buf.WriteString("\tif err != nil {\n")
+			buf.WriteString("\t\treturn nil, err\n")
+			buf.WriteString("\t}\n")
+		}
+		if len(field.EnumValues) > 0 {
+			// Only values given on the command line are checked, defaults need not be one of the constants
+			buf.WriteString(fmt.Sprintf("\tif flags.Changed(%s) {\n", flagConst))
+			buf.WriteString(fmt.Sprintf("\t\tswitch %s {\n", valueVar))
+			buf.WriteString(fmt.Sprintf("\t\tcase %s:\n", strings.Join(field.EnumValues, ", ")))
+			buf.WriteString("\t\tdefault:\n")
+			buf.WriteString(fmt.Sprintf("\t\t\treturn nil, fmt.Errorf(\"invalid value %%v for flag --%%s (one of: %%s)\", %s, %s, %q)\n",
+				valueVar, flagConst, enumChoices(field)))
+			buf.WriteString("\t\t}\n")
+			buf.WriteString("\t}\n")
+		}
+		if field.UnderlyingType != "" {
+			buf.WriteString(fmt.Sprintf("\t%s := %s(%s)\n", localVar, field.Type, valueVar))
+		}
+	}
+}
 
-		buf.WriteString(fmt.Sprintf("\tflags.%s(%s, %s, %q)\n",
-			pflagType, flagConst, defaultVal, comment))
+// writeEnumNameGetter writes the statements declaring localVar with the constant named by a namedEnum flag.
+// A default that is none of the constants has no name, the field then keeps its zero value.
+func writeEnumNameGetter(buf *bytes.Buffer, field fieldInfo, localVar, flagConst string) {
+	nameVar := localVar + "Name"
+	buf.WriteString(fmt.Sprintf("\t%s, err := flags.GetString(%s)\n", nameVar, flagConst))
+	buf.WriteString("\tif err != nil {\n")
+	buf.WriteString("\t\treturn nil, err\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString(fmt.Sprintf("\tvar %s %s\n", localVar, field.Type))
+	buf.WriteString(fmt.Sprintf("\tswitch %s {\n", nameVar))
+	for _, name := range field.EnumNames {
+		buf.WriteString(fmt.Sprintf("\tcase %q:\n", enumFlagValue(field, name)))
+		buf.WriteString(fmt.Sprintf("\t\t%s = %s\n", localVar, name))
 	}
-	// Register embedded struct flags
-	for _, embedded := range embeddedStructs {
-		buf.WriteString(fmt.Sprintf("\n\t// %s flags\n", embedded.TypeName))
-		for _, field := range embedded.Fields {
-			if field.Skip {
-				continue
-			}
-			flagConst := embeddedFieldFlagName(embedded.TypeName, field.Name)
-			pflagType := getPflagType(field.Type)
-			comment := field.Comment
-			if comment == "" {
-				comment = fmt.Sprintf("set %s default value", camelToKebab(field.Name))
-			}
+	buf.WriteString("\tdefault:\n")
+	buf.WriteString(fmt.Sprintf("\t\tif flags.Changed(%s) {\n", flagConst))
+	buf.WriteString(fmt.Sprintf("\t\t\treturn nil, fmt.Errorf(\"invalid value %%q for flag --%%s (one of: %%s)\", %s, %s, %q)\n",
+		nameVar, flagConst, enumChoices(field)))
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t}\n")
+}
 
-			defaultVal := field.DefaultValueRef
-			if defaultVal == "" {
-				defaultVal = formatDefaultValue(field.Type, field.DefaultValue)
-			}
+// flagField is a field with its own flag, along with the names derived from its path in the struct
+type flagField struct {
+	fieldInfo
+	ConstName string // constant holding the flag name, e.g. flagDbHost
+	FlagName  string // e.g. db-host
+	LocalVar  string // variable holding the value in load<Struct>, e.g. dbHost
+	Group     string // path of the nested struct the field belongs to, e.g. db; empty for top-level fields
+}
+
+// flattenFields expands nested struct fields into the fields that get flags.
+// Direct fields of a struct come before the fields of its nested structs.
+func flattenFields(fields []fieldInfo) []flagField {
+	return appendFlagFields(nil, fields, flagField{ConstName: "flag"})
+}
 
-			buf.WriteString(fmt.Sprintf("\tflags.%s(%s, %s, %q)\n",
-				pflagType, flagConst, defaultVal, comment))
+func appendFlagFields(out []flagField, fields []fieldInfo, parent flagField) []flagField {
+	name := func(field fieldInfo) flagField {
+		flagName := camelToKebab(field.Name)
+		if field.Tag.Name != "" {
+			flagName = field.Tag.Name
+		}
+		f := flagField{
+			fieldInfo: field,
+			ConstName: parent.ConstName + identConstName(field.Name),
+			FlagName:  flagName,
+			LocalVar:  field.Name,
+			Group:     parent.Group,
+		}
+		if parent.LocalVar != "" {
+			f.FlagName = parent.FlagName + "-" + flagName
+			f.LocalVar = parent.LocalVar + strings.Title(field.Name)
+		}
+		// Structs embedded in nested structs promote their flags to the parent, unless tagged with prefix=
+		if field.IsEmbedded {
+			f.ConstName, f.FlagName = parent.ConstName, parent.FlagName
+			if field.Tag.Prefix != "" {
+				f.ConstName += kebabToConstName(field.Tag.Prefix)
+				f.FlagName += "-" + field.Tag.Prefix
+			}
 		}
+		return f
 	}
-	buf.WriteString("}\n\n")
 
-	// Collect skipped fields for loadConfig parameters
-	var skippedFields []fieldInfo
 	for _, field := range fields {
-		if field.Skip {
-			skippedFields = append(skippedFields, field)
+		if !field.IsStruct || field.Skip {
+			out = append(out, name(field))
 		}
 	}
-
-	// Generate loadConfig function signature
-	buf.WriteString("func load" + structNameC + "(flags *pflag.FlagSet")
-	for _, field := range skippedFields {
-		buf.WriteString(fmt.Sprintf(", %s %s", field.Name, field.Type))
+	for _, field := range fields {
+		if field.IsStruct && !field.Skip {
+			group := name(field)
+			group.Group = strings.TrimPrefix(parent.Group+"."+field.Name, ".")
+			out = appendFlagFields(out, field.Fields, group)
+		}
 	}
-	buf.WriteString(fmt.Sprintf(") (*%s, error) {\n", structName))
+	return out
+}
 
-	// Generate flag getters for regular fields
+// writeFieldValues writes the keyed elements of the struct literal returned by load<Struct>,
+// building nested structs from the local variables of their fields
+func writeFieldValues(buf *bytes.Buffer, fields []fieldInfo, localPrefix string) {
 	for _, field := range fields {
-		if field.Skip {
+		localVar := field.Name
+		if localPrefix != "" {
+			localVar = localPrefix + strings.Title(field.Name)
+		}
+		if !field.IsStruct || field.Skip {
+			buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", field.Name, localVar))
 			continue
 		}
-		flagConst := "flag" + strings.Title(field.Name)
-		getterType := getFlagGetterType(field.Type)
+		if field.Pointer {
+			buf.WriteString(fmt.Sprintf("\t\t%s: &%s{\n", field.Name, field.Type))
+		} else {
+			buf.WriteString(fmt.Sprintf("\t\t%s: %s{\n", field.Name, field.Type))
+		}
+		writeFieldValues(buf, field.Fields, localVar)
+		buf.WriteString("\t\t},\n")
+	}
+}
 
-		buf.WriteString(fmt.Sprintf("\t%s, err := flags.%s(%s)\n", field.Name, getterType, flagConst))
-		buf.WriteString("\tif err != nil {\n")
-		buf.WriteString("\t\treturn nil, err\n")
-		buf.WriteString("\t}\n\n")
+// embeddedFlagFields lists the flags of embedded struct fields, including the structs they embed,
+// grouped by embedding path, e.g. ServerOptions.TLSOptions
+func embeddedFlagFields(embeddedStructs []embeddedStructInfo) []flagField {
+	return appendEmbeddedFlagFields(nil, embeddedStructs, flagField{})
+}
+
+// appendEmbeddedFlagFields appends the flags of embedded structs to out. Embeds tagged with prefix= or inline
+// name their flags after parent's prefix and their own, untagged embeds after their type name.
+func appendEmbeddedFlagFields(out []flagField, embeddedStructs []embeddedStructInfo, parent flagField) []flagField {
+	for _, embedded := range embeddedStructs {
+		if embedded.Tag.Skip {
+			out = append(out, skippedEmbedField(embedded, parent))
+			continue
+		}
+
+		prefix := parent
+		prefix.LocalVar = embeddedLocalName(parent.LocalVar, embedded.TypeName)
+		prefix.Group = strings.TrimPrefix(parent.Group+"."+embedded.TypeName, ".")
+		switch {
+		case embedded.Tag.Inline:
+		case embedded.Tag.Prefix != "":
+			prefix.ConstName += kebabToConstName(embedded.Tag.Prefix)
+			prefix.FlagName = strings.TrimPrefix(prefix.FlagName+"-"+embedded.Tag.Prefix, "-")
+		}
+
+		// Fields of the embedded struct are named like the fields of the struct, nested structs included,
+		// then prefixed after the embed
+		for _, field := range flattenFields(embedded.Fields) {
+			f := field
+			f.LocalVar = prefix.LocalVar + strings.Title(field.LocalVar)
+			f.Group = strings.TrimSuffix(prefix.Group+"."+field.Group, ".")
+			if embedded.Tag.Inline || embedded.Tag.Prefix != "" {
+				f.ConstName = "flag" + prefix.ConstName + strings.TrimPrefix(field.ConstName, "flag")
+				f.FlagName = strings.TrimPrefix(prefix.FlagName+"-"+field.FlagName, "-")
+			} else {
+				f.ConstName = embeddedFieldFlagName(embedded.TypeName, field)
+				// Direct fields named with name= keep their name
+				if field.Group != "" || field.Tag.Name == "" {
+					f.FlagName = embeddedFieldKebabName(embedded.TypeName, field)
+				}
+			}
+			out = append(out, f)
+		}
+		out = appendEmbeddedFlagFields(out, embedded.Embedded, prefix)
 	}
+	return out
+}
 
-	// Generate flag getters for embedded struct fields
+// skippedEmbedField returns the load<Struct> parameter of an embed tagged `pflags:"-"`
+func skippedEmbedField(embedded embeddedStructInfo, parent flagField) flagField {
+	field := fieldInfo{
+		Name:    embedded.TypeName,
+		Type:    embedded.TypeName,
+		Skip:    true,
+		Pointer: embedded.Pointer,
+	}
+	if embedded.PkgAlias != "" {
+		field.Type = embedded.PkgAlias + "." + embedded.TypeName
+	}
+	return flagField{fieldInfo: field, LocalVar: embeddedLocalName(parent.LocalVar, embedded.TypeName), Group: parent.Group}
+}
+
+// writeEmbeddedValues writes the embedded struct elements of the struct literal returned by load<Struct>,
+// nesting the structs they embed. parentLocalName is the load<Struct> name of the struct embedding them, if any.
+func writeEmbeddedValues(buf *bytes.Buffer, embeddedStructs []embeddedStructInfo, parentLocalName string) {
 	for _, embedded := range embeddedStructs {
-		buf.WriteString(fmt.Sprintf("\t// %s\n", embedded.TypeName))
-		for _, field := range embedded.Fields {
-			if field.Skip {
-				continue
+		localName := embeddedLocalName(parentLocalName, embedded.TypeName)
+		if embedded.Tag.Skip {
+			buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", embedded.TypeName, localName))
+			continue
+		}
+		typeName := embedded.TypeName
+		if embedded.PkgAlias != "" {
+			typeName = embedded.PkgAlias + "." + typeName
+		}
+		if embedded.Pointer {
+			typeName = "&" + typeName
+		}
+		buf.WriteString(fmt.Sprintf("\t\t%s: %s{\n", embedded.TypeName, typeName))
+		writeFieldValues(buf, embedded.Fields, localName)
+		writeEmbeddedValues(buf, embedded.Embedded, localName)
+		buf.WriteString("\t\t},\n")
+	}
+}
+
+// defaultValue is the default value of a struct, e.g. defaultConfig or defaultConfig.ServerOptions, along with
+// its composite literal when the fields it sets are known
+type defaultValue struct {
+	Ref  string
+	Lit  *ast.CompositeLit
+	Call string // function returning the default value, assigned to Ref in with<Struct>Flags
+}
+
+// propagateEmbeddedDefaults points embedded fields at their defaults. An embedded struct set in its parent's
+// default uses it, spelling out the embedding path so that fields shadowed by shallower ones keep their own
+// defaults, e.g. defaultConfig.ServerOptions.TLSOptions.Enabled. Otherwise, the default variable of the embedded
+// type is used when its package declares one, e.g. types.DefaultTLSOptions, and fields start from zero values
+// when there is none.
+func propagateEmbeddedDefaults(resolver *typeResolver, embeddedStructs []embeddedStructInfo, parent *defaultValue) error {
+	for i := range embeddedStructs {
+		embedded := &embeddedStructs[i]
+		if embedded.Tag.Skip {
+			continue
+		}
+
+		var def *defaultValue
+		if parent != nil {
+			if parent.Lit == nil {
+				// The whole parent is set, but a pointer embed in it may be nil
+				if !embedded.Pointer {
+					def = &defaultValue{Ref: parent.Ref + "." + embedded.TypeName}
+				}
+			} else if value, ok := literalKeys(parent.Lit)[embedded.TypeName]; ok && !isNil(value) {
+				def = &defaultValue{Ref: parent.Ref + "." + embedded.TypeName, Lit: compositeLiteral(value)}
 			}
-			flagConst := embeddedFieldFlagName(embedded.TypeName, field.Name)
-			getterType := getFlagGetterType(field.Type)
-			// Use lowercase first char for local variable
-			localVarName := lowerFirst(field.Name)
+		}
+		if def == nil {
+			var err error
+			if def, err = embeddedTypeDefault(resolver, embedded); err != nil {
+				return err
+			}
+		}
 
-			buf.WriteString(fmt.Sprintf("\t%s, err := flags.%s(%s)\n", localVarName, getterType, flagConst))
-			buf.WriteString("\tif err != nil {\n")
-			buf.WriteString("\t\treturn nil, err\n")
-			buf.WriteString("\t}\n\n")
+		// Fields of the embedded struct, and of the structs nested in it, default like the fields of the struct
+		mergeDefaults(embedded.Fields, def)
+		propagateDefaults(embedded.Fields)
+		if err := propagateEmbeddedDefaults(resolver, embedded.Embedded, def); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Generate return statement
-	buf.WriteString(fmt.Sprintf("\treturn &%s{\n", structName))
+// embeddedTypeDefault returns the default variable declared next to an embedded struct type:
+// Default<Type>, or default<Type> for structs of the package being generated
+func embeddedTypeDefault(resolver *typeResolver, embedded *embeddedStructInfo) (*defaultValue, error) {
+	pkg, err := resolver.loadPackage(embedded.PkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{"Default" + embedded.TypeName}
+	if embedded.PkgPath == "" {
+		names = append(names, "default"+strings.Title(embedded.TypeName))
+	}
+	name, value := findVar(pkg.Syntax, names...)
+	if value == nil || isNil(value) {
+		return nil, nil
+	}
+	if embedded.PkgAlias != "" {
+		name = embedded.PkgAlias + "." + name
+	}
+	return &defaultValue{Ref: name, Lit: compositeLiteral(value)}, nil
+}
+
+// compositeLiteral unwraps T{...} and &T{...}, returning nil for any other expression
+func compositeLiteral(expr ast.Expr) *ast.CompositeLit {
+	if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		expr = unary.X
+	}
+	compositeLit, _ := expr.(*ast.CompositeLit)
+	return compositeLit
+}
+
+// isNil reports whether expr is the nil identifier
+func isNil(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "nil"
+}
+
+// mergeDefaults points the fields of a struct at the matching fields of its default, if any: the fields set in its
+// composite literal, or all of them when the fields it sets are not known
+func mergeDefaults(fields []fieldInfo, def *defaultValue) {
+	if def == nil {
+		return
+	}
+	var keys map[string]ast.Expr
+	if def.Lit != nil {
+		keys = literalKeys(def.Lit)
+	}
+	for i := range fields {
+		value, ok := keys[fields[i].Name]
+		// Pointer struct fields may be nil, they are only followed when the defaults set them
+		if fields[i].IsStruct && fields[i].Pointer && (!ok || isNil(value)) {
+			continue
+		}
+		if ok || (keys == nil && !fields[i].Skip) {
+			fields[i].DefaultValueRef = def.Ref + "." + fields[i].Name
+		}
+	}
+}
+
+// walkFields calls fn for every field, including the fields of nested structs that are not skipped
+func walkFields(fields []fieldInfo, fn func(fieldInfo)) {
 	for _, field := range fields {
-		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", field.Name, field.Name))
+		fn(field)
+		if !field.Skip {
+			walkFields(field.Fields, fn)
+		}
 	}
-	// Add embedded struct initialization
-	for _, embedded := range embeddedStructs {
-		buf.WriteString(fmt.Sprintf("\t\t%s: %s.%s{\n", embedded.TypeName, embedded.PkgAlias, embedded.TypeName))
-		for _, field := range embedded.Fields {
-			localVarName := lowerFirst(field.Name)
-			buf.WriteString(fmt.Sprintf("\t\t\t%s: %s,\n", field.Name, localVarName))
+}
+
+// propagateDefaults sets the default references of nested struct fields from their parent's,
+// e.g. defaultConfig.db -> defaultConfig.db.host. Pointer structs nested in them may be nil and start from zero
+// values.
+func propagateDefaults(fields []fieldInfo) {
+	for i := range fields {
+		if !fields[i].IsStruct {
+			continue
 		}
-		buf.WriteString("\t\t},\n")
+		for j := range fields[i].Fields {
+			child := fields[i].Fields[j]
+			if fields[i].DefaultValueRef != "" && !(child.IsStruct && child.Pointer) {
+				fields[i].Fields[j].DefaultValueRef = fields[i].DefaultValueRef + "." + fields[i].Fields[j].Name
+			}
+		}
+		propagateDefaults(fields[i].Fields)
 	}
-	buf.WriteString("\t}, nil\n")
-	buf.WriteString("}\n")
+}
+
+func generatePflagsCode(structs []structFlags, packageName string) string {
+	var buf bytes.Buffer
+
+	// Add "// Code generated by struct-to-pflags; DO NOT EDIT." comment
+	buf.WriteString("// Code generated by struct-to-pflags; DO NOT EDIT.\n\n")
+
+	// Add package statement
+	buf.WriteString(fmt.Sprintf("package %s\n\n", packageName))
+
+	// Determine required imports
+	stdImports, otherImports := requiredImports(structs)
+
+	// Add imports
+	buf.WriteString("import (\n")
+	for _, imp := range stdImports {
+		buf.WriteString(fmt.Sprintf("\t%s\n", imp))
+	}
+	if len(stdImports) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, imp := range otherImports {
+		buf.WriteString(fmt.Sprintf("\t%s\n", imp))
+	}
+	buf.WriteString(")\n\n")
 
-	// Add helper to ensure time import is used if needed
-	if needsTime {
+	// Each struct gets its constants and functions, one after another
+	for i, s := range structs {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		writeStructCode(&buf, s)
+	}
+
+	// Add helpers to ensure imports are used if needed
+	var guards []string
+	for _, imp := range stdImports {
+		if guard, ok := importGuards[imp.Path]; ok {
+			guards = append(guards, guard)
+		}
+	}
+	if len(guards) > 0 {
 		buf.WriteString("\n// Ensure unused import is used\n")
-		buf.WriteString("var _ = time.Second\n")
+		for _, guard := range guards {
+			buf.WriteString(fmt.Sprintf("var _ = %s\n", guard))
+		}
 	}
 
 	// Format the generated code
@@ -765,3 +1747,138 @@ func generatePflagsCode(fields []fieldInfo, embeddedStructs []embeddedStructInfo
 
 	return string(formatted)
 }
+
+// writeStructCode writes the flag constants, with<Struct>Flags and load<Struct> of a struct
+func writeStructCode(buf *bytes.Buffer, s structFlags) {
+	structNameC := strings.Title(s.Name)
+
+	flagFields := s.flagFields()
+	embeddedFields := s.embeddedFlagFields()
+
+	// Generate flag constant names
+	buf.WriteString("const (\n")
+	lastGroup := ""
+	for _, field := range flagFields {
+		if field.Skip {
+			continue
+		}
+		if field.Group != lastGroup {
+			buf.WriteString(fmt.Sprintf("\n\t// %s flags\n", field.Group))
+			lastGroup = field.Group
+		}
+		buf.WriteString(fmt.Sprintf("\t%s = \"%s\"\n", field.ConstName, field.FlagName))
+	}
+	// Generate flag constants for embedded struct fields
+	lastGroup = ""
+	for _, field := range embeddedFields {
+		if field.Skip {
+			continue
+		}
+		if field.Group != lastGroup {
+			buf.WriteString(fmt.Sprintf("\n\t// %s flags\n", field.Group))
+			lastGroup = field.Group
+		}
+		buf.WriteString(fmt.Sprintf("\t%s = \"%s\"\n", field.ConstName, field.FlagName))
+	}
+	buf.WriteString(")\n\n")
+
+	// Generate withFlags function
+	buf.WriteString("func with" + structNameC + "Flags(flags *pflag.FlagSet) {\n")
+	if s.DefaultsCall != "" && referencesDefaults(append(flagFields, embeddedFields...)) {
+		buf.WriteString(fmt.Sprintf("\t%s := %s()\n\n", defaultsLocalVar, s.DefaultsCall))
+	}
+	lastGroup = ""
+	for _, field := range flagFields {
+		if field.Skip {
+			continue
+		}
+		if field.Group != lastGroup {
+			buf.WriteString(fmt.Sprintf("\n\t// %s flags\n", field.Group))
+			lastGroup = field.Group
+		}
+		comment := fieldUsage(field.fieldInfo, field.Comment)
+
+		writeFlagRegistration(buf, field.fieldInfo, field.LocalVar, field.ConstName, comment, s.Cobra)
+	}
+	// Register embedded struct flags
+	lastGroup = ""
+	for _, field := range embeddedFields {
+		if field.Skip {
+			continue
+		}
+		if field.Group != lastGroup {
+			buf.WriteString(fmt.Sprintf("\n\t// %s flags\n", field.Group))
+			lastGroup = field.Group
+		}
+		comment := field.Comment
+		if comment == "" {
+			comment = fmt.Sprintf("set %s default value", camelToKebab(field.Name))
+		}
+		comment = fieldUsage(field.fieldInfo, comment)
+
+		writeFlagRegistration(buf, field.fieldInfo, field.LocalVar, field.ConstName, comment, s.Cobra)
+	}
+	buf.WriteString("}\n\n")
+
+	// Generate loadConfig function signature, with skipped fields as parameters
+	buf.WriteString("func load" + structNameC + "(flags *pflag.FlagSet")
+	for _, field := range append(flagFields, embeddedFields...) {
+		if field.Skip {
+			buf.WriteString(fmt.Sprintf(", %s %s", field.LocalVar, fieldGoType(field.fieldInfo)))
+		}
+	}
+	buf.WriteString(fmt.Sprintf(") (*%s, error) {\n", s.Name))
+
+	// Check required flags before reading any of them
+	var requiredFlags []string
+	for _, field := range flagFields {
+		if !field.Skip && field.Tag.Required {
+			requiredFlags = append(requiredFlags, field.ConstName)
+		}
+	}
+	for _, field := range embeddedFields {
+		if !field.Skip && field.Tag.Required {
+			requiredFlags = append(requiredFlags, field.ConstName)
+		}
+	}
+	if len(requiredFlags) > 0 {
+		buf.WriteString("\tvar missingFlags []string\n")
+		buf.WriteString(fmt.Sprintf("\tfor _, name := range []string{%s} {\n", strings.Join(requiredFlags, ", ")))
+		buf.WriteString("\t\tif !flags.Changed(name) {\n")
+		buf.WriteString("\t\t\tmissingFlags = append(missingFlags, \"--\"+name)\n")
+		buf.WriteString("\t\t}\n")
+		buf.WriteString("\t}\n")
+		buf.WriteString("\tif len(missingFlags) > 0 {\n")
+		buf.WriteString("\t\treturn nil, fmt.Errorf(\"required flags not set: %s\", strings.Join(missingFlags, \", \"))\n")
+		buf.WriteString("\t}\n\n")
+	}
+
+	// Generate flag getters for regular and nested fields
+	for _, field := range flagFields {
+		if field.Skip {
+			continue
+		}
+		writeFlagGetter(buf, field.fieldInfo, field.LocalVar, field.ConstName)
+	}
+
+	// Generate flag getters for embedded struct fields
+	lastGroup = ""
+	for _, field := range embeddedFields {
+		if field.Skip {
+			continue
+		}
+		if field.Group != lastGroup {
+			buf.WriteString(fmt.Sprintf("\t// %s\n", field.Group))
+			lastGroup = field.Group
+		}
+		writeFlagGetter(buf, field.fieldInfo, field.LocalVar, field.ConstName)
+	}
+
+	// Generate return statement
+	buf.WriteString(fmt.Sprintf("\treturn &%s{\n", s.Name))
+	writeFieldValues(buf, s.Fields, "")
+	// Add embedded struct initialization
+	writeEmbeddedValues(buf, s.Embedded, "")
+	buf.WriteString("\t}, nil\n")
+	buf.WriteString("}\n")
+}
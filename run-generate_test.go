@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCamelToKebab(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "port", want: "port"},
+		{name: "logFile", want: "log-file"},
+		{name: "httpPort", want: "http-port"},
+		{name: "HTTPPort", want: "http-port"},
+		{name: "userID", want: "user-id"},
+		{name: "userIDs", want: "user-ids"},
+		{name: "URLs", want: "urls"},
+		{name: "baseURL", want: "base-url"},
+		{name: "HTTPSecure", want: "http-secure"},
+		{name: "isS3Enabled", want: "is-s3-enabled"},
+		{name: "APIsEnabled", want: "apis-enabled"},
+		{name: "ipv6Enabled", want: "ipv6-enabled"},
+		{name: "TLS", want: "tls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := camelToKebab(tt.name); got != tt.want {
+				t.Errorf("camelToKebab(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKebabToConstName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "server", want: "Server"},
+		{name: "db", want: "Db"},
+		{name: "tls", want: "TLS"},
+		{name: "http-server", want: "HTTPServer"},
+		{name: "api-v2", want: "APIV2"},
+		{name: "grpc-tls-ca", want: "GrpcTLSCa"},
+		{name: "user-ids", want: "UserIDs"},
+		{name: "is", want: "Is"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kebabToConstName(tt.name); got != tt.want {
+				t.Errorf("kebabToConstName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentConstName(t *testing.T) {
+	tests := []struct {
+		ident string
+		want  string
+	}{
+		{ident: "logFile", want: "LogFile"},
+		{ident: "httpPort", want: "HTTPPort"},
+		{ident: "HTTPPort", want: "HTTPPort"},
+		{ident: "tls", want: "TLS"},
+		{ident: "dnsServer", want: "DNSServer"},
+		{ident: "userIDs", want: "UserIDs"},
+		{ident: "APIsEnabled", want: "APIsEnabled"},
+		{ident: "isS3Enabled", want: "IsS3Enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ident, func(t *testing.T) {
+			if got := identConstName(tt.ident); got != tt.want {
+				t.Errorf("identConstName(%q) = %q, want %q", tt.ident, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnumFlagValue(t *testing.T) {
+	tests := []struct {
+		fieldType string
+		name      string
+		want      string
+	}{
+		{fieldType: "mode", name: "modeFast", want: "fast"},
+		{fieldType: "mode", name: "ModeFast", want: "fast"},
+		{fieldType: "mode", name: "modest", want: "modest"},
+		{fieldType: "mode", name: "fastMode", want: "fast-mode"},
+		{fieldType: "mode", name: "mode", want: "mode"},
+		{fieldType: "k.Protocol", name: "k.ProtocolHTTP2", want: "http2"},
+		{fieldType: "k.Protocol", name: "k.TCP", want: "tcp"},
+		{fieldType: "level", name: "levelDebugVerbose", want: "debug-verbose"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := fieldInfo{Type: tt.fieldType}
+			if got := enumFlagValue(field, tt.name); got != tt.want {
+				t.Errorf("enumFlagValue(%s, %q) = %q, want %q", tt.fieldType, tt.name, got, tt.want)
+			}
+		})
+	}
+}
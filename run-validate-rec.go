@@ -8,21 +8,32 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 // generateDirective represents a parsed go:generate directive
 type generateDirective struct {
-	sourceFile string
-	filePath   string
-	structName string
-	outputFile string
-	pkgName    string
-	lineNumber int
+	sourceFile  string
+	filePath    string
+	structNames []string
+	outputFile  string
+	pkgName     string
+	cobra       bool
+	defaults    []string
+	prefixes    []string
+	dir         string // -dir: the structs come from //pflags:generate markers
+	lineNumber  int
+}
+
+// validation is a generated file to validate, named after what it is generated from
+type validation struct {
+	name string
+	cfg  *generatorConfig
 }
 
 func validateRecursive() {
-	var rootDir = flag.String("dir", ".", "root directory to search for go:generate directives")
+	var rootDir = flag.String("dir", ".", "root directory to search for go:generate directives and "+markerComment+" markers")
 	flag.Parse()
 
 	directives, err := findGenerateDirectives(*rootDir)
@@ -30,32 +41,91 @@ func validateRecursive() {
 		log.Fatalf("failed to find generate directives: %v", err)
 	}
 
-	if len(directives) == 0 {
-		fmt.Printf("No go:generate struct-to-pflags directives found in %s\n", *rootDir)
+	// Marked packages are validated once, with -cobra if a go:generate -dir directive covering them has it
+	var validations []validation
+	var marked []markedPackage
+	seen := make(map[string]bool)
+	addMarked := func(pattern string, cobra bool) {
+		pkgs, err := findMarkedPackages(pattern)
+		if err != nil {
+			log.Fatalf("failed to find %s markers: %v", markerComment, err)
+		}
+		for _, pkg := range pkgs {
+			if !seen[pkg.Dir] {
+				seen[pkg.Dir] = true
+				marked = append(marked, pkg)
+				validations = append(validations, validation{
+					name: fmt.Sprintf("%s (%s)", pkg.Dir, markerComment),
+					cfg:  pkg.config(cobra),
+				})
+			}
+		}
+	}
+	for _, directive := range directives {
+		if directive.dir != "" {
+			addMarked(directive.dir, directive.cobra)
+			continue
+		}
+		validations = append(validations, validation{
+			name: directive.sourceFile,
+			cfg: &generatorConfig{
+				filePath:    directive.filePath,
+				structNames: directive.structNames,
+				outputFile:  directive.outputFile,
+				packageName: directive.pkgName,
+				cobra:       directive.cobra,
+				defaults:    directive.defaults,
+				prefixes:    directive.prefixes,
+			},
+		})
+	}
+	markedOnly := len(validations)
+	addMarked(filepath.Join(*rootDir, "..."), false)
+	markedOnly = len(validations) - markedOnly
+
+	// pflags.gen.go files of packages without markers are left over, unless a go:generate directive writes them
+	orphans, err := findOrphanedOutputs(filepath.Join(*rootDir, "..."), marked)
+	if err != nil {
+		log.Fatalf("failed to find %s files: %v", markerOutputFile, err)
+	}
+	outputs := make(map[string]bool)
+	for _, directive := range directives {
+		outputs[filepath.Clean(directive.outputFile)] = true
+	}
+	orphans = slices.DeleteFunc(orphans, func(orphan string) bool {
+		return outputs[filepath.Clean(orphan)]
+	})
+
+	if len(validations) == 0 && len(orphans) == 0 {
+		fmt.Printf("No go:generate struct-to-pflags directives or %s markers found in %s\n", markerComment, *rootDir)
 		return
 	}
 
-	fmt.Printf("Found %d go:generate struct-to-pflags directive(s)\n\n", len(directives))
+	if markedOnly > 0 {
+		fmt.Printf("Found %d go:generate struct-to-pflags directive(s) and %d package(s) with %s markers\n\n", len(directives), markedOnly, markerComment)
+	} else {
+		fmt.Printf("Found %d go:generate struct-to-pflags directive(s)\n\n", len(directives))
+	}
 
+	total := len(validations) + len(orphans)
 	var failed []string
-	for i, directive := range directives {
-		fmt.Printf("[%d/%d] Validating %s...\n", i+1, len(directives), directive.sourceFile)
-
-		cfg := &generatorConfig{
-			filePath:    directive.filePath,
-			structName:  directive.structName,
-			outputFile:  directive.outputFile,
-			packageName: directive.pkgName,
-		}
+	for i, v := range validations {
+		fmt.Printf("[%d/%d] Validating %s...\n", i+1, total, v.name)
 
-		if err := validateGen(cfg); err != nil {
-			failed = append(failed, directive.sourceFile)
+		if err := validateGen(v.cfg); err != nil {
+			failed = append(failed, v.name)
 			fmt.Fprintf(os.Stderr, "  ✗ FAILED: %v\n\n", err)
 			continue
 		}
 
 		fmt.Printf("  ✓ OK\n\n")
 	}
+	for i, orphan := range orphans {
+		fmt.Printf("[%d/%d] Validating %s...\n", len(validations)+i+1, total, orphan)
+		reportOrphanedOutput(orphan)
+		failed = append(failed, orphan)
+		fmt.Fprintf(os.Stderr, "  ✗ FAILED: %s has no %s markers left\n\n", filepath.Dir(orphan), markerComment)
+	}
 
 	if len(failed) > 0 {
 		fmt.Fprintf(os.Stderr, "\n%d file(s) failed validation:\n", len(failed))
@@ -65,7 +135,7 @@ func validateRecursive() {
 		os.Exit(1)
 	}
 
-	fmt.Printf("All %d file(s) validated successfully!\n", len(directives))
+	fmt.Printf("All %d file(s) validated successfully!\n", total)
 }
 
 // findGenerateDirectives walks the directory tree and finds all go:generate struct-to-pflags directives
@@ -163,7 +233,7 @@ func parseGenerateDirective(sourceFile, args string, lineNum int) (generateDirec
 				return directive, fmt.Errorf("missing value for -struct flag")
 			}
 			i++
-			directive.structName = parts[i]
+			directive.structNames = append(directive.structNames, strings.Split(parts[i], ",")...)
 
 		case "-output":
 			if i+1 >= len(parts) {
@@ -180,14 +250,47 @@ func parseGenerateDirective(sourceFile, args string, lineNum int) (generateDirec
 			}
 			i++
 			directive.pkgName = parts[i]
+
+		case "-defaults":
+			if i+1 >= len(parts) {
+				return directive, fmt.Errorf("missing value for -defaults flag")
+			}
+			i++
+			directive.defaults = append(directive.defaults, strings.Split(parts[i], ",")...)
+
+		case "-prefix":
+			if i+1 >= len(parts) {
+				return directive, fmt.Errorf("missing value for -prefix flag")
+			}
+			i++
+			directive.prefixes = append(directive.prefixes, strings.Split(parts[i], ",")...)
+
+		case "-dir":
+			if i+1 >= len(parts) {
+				return directive, fmt.Errorf("missing value for -dir flag")
+			}
+			i++
+			// Resolve relative path from the source file's directory
+			directive.dir = filepath.Join(filepath.Dir(sourceFile), parts[i])
+
+		case "-cobra":
+			// Boolean flag: either bare or followed by its value
+			directive.cobra = true
+			if i+1 < len(parts) && (parts[i+1] == "true" || parts[i+1] == "false") {
+				i++
+				directive.cobra = parts[i] == "true"
+			}
 		}
 	}
 
-	// Validate required fields
+	// Validate required fields, -dir takes them from the markers
+	if directive.dir != "" {
+		return directive, nil
+	}
 	if directive.filePath == "" {
 		return directive, fmt.Errorf("missing -file flag")
 	}
-	if directive.structName == "" {
+	if len(directive.structNames) == 0 {
 		return directive, fmt.Errorf("missing -struct flag")
 	}
 	if directive.outputFile == "" {
@@ -11,11 +11,49 @@ import (
 
 func validate() {
 	cfg := parseFlags()
+	if cfg.dir != "" {
+		validateDir(cfg)
+		return
+	}
 	if err := validateGen(cfg); err != nil {
 		log.Fatalf("validation failed: %v", err)
 	}
 }
 
+// validateDir validates the code generated for the marked structs of every package matching cfg.dir
+func validateDir(cfg *generatorConfig) {
+	pkgs, err := findMarkedPackages(cfg.dir)
+	if err != nil {
+		log.Fatalf("failed to find %s markers: %v", markerComment, err)
+	}
+
+	orphans, err := findOrphanedOutputs(cfg.dir, pkgs)
+	if err != nil {
+		log.Fatalf("failed to find %s files: %v", markerOutputFile, err)
+	}
+
+	var failed int
+	for _, pkg := range pkgs {
+		if err := validateGen(pkg.config(cfg.cobra)); err != nil {
+			failed++
+		}
+	}
+	for _, orphan := range orphans {
+		reportOrphanedOutput(orphan)
+		failed++
+	}
+	if failed > 0 {
+		log.Fatalf("validation failed: %d of %d file(s) are out of date", failed, len(pkgs)+len(orphans))
+	}
+}
+
+// reportOrphanedOutput reports a markerOutputFile left behind after the last marker of its package was removed
+func reportOrphanedOutput(path string) {
+	fmt.Fprintf(os.Stderr, "✗ %s is out of date\n\n", path)
+	fmt.Fprintf(os.Stderr, "No struct of its package is marked with %s anymore.\n", markerComment)
+	fmt.Fprintf(os.Stderr, "To fix this, delete it or mark the structs it was generated for.\n\n")
+}
+
 func validateGen(cfg *generatorConfig) error {
 	// Generate expected code
 	expectedCode, err := generateCode(cfg)
@@ -52,14 +90,55 @@ func validateGen(cfg *generatorConfig) error {
 	fmt.Fprintf(os.Stderr, "  - Struct fields were added, removed, or renamed\n")
 	fmt.Fprintf(os.Stderr, "  - Field types were changed\n")
 	fmt.Fprintf(os.Stderr, "  - Field comments were modified\n")
-	fmt.Fprintf(os.Stderr, "  - Default values in default%s were changed\n", strings.Title(cfg.structName))
+	fmt.Fprintf(os.Stderr, "  - Default values in %s were changed\n", defaultsNames(cfg))
 	fmt.Fprintf(os.Stderr, "\nTo fix this, run:\n")
-	fmt.Fprintf(os.Stderr, "  struct-to-pflags -file %s -struct %s -output %s\n\n", cfg.filePath, cfg.structName, cfg.outputFile)
+	if cfg.dir != "" {
+		fmt.Fprintf(os.Stderr, "  struct-to-pflags -dir %s%s\n\n", cfg.dir, extraGenerateArgs(cfg))
+	} else {
+		fmt.Fprintf(os.Stderr, "  struct-to-pflags -file %s -struct %s -output %s%s\n\n", cfg.filePath, strings.Join(cfg.structNames, ","), cfg.outputFile, extraGenerateArgs(cfg))
+	}
 	fmt.Fprintf(os.Stderr, "Diff:\n%s\n", diffText)
 
 	return fmt.Errorf("%s is out of date", cfg.outputFile)
 }
 
+// extraGenerateArgs returns the optional generator flags needed to reproduce cfg. Configurations from
+// //pflags:generate markers only need -cobra, the markers hold the rest.
+func extraGenerateArgs(cfg *generatorConfig) string {
+	var args string
+	if cfg.dir != "" {
+		if cfg.cobra {
+			args += " -cobra"
+		}
+		return args
+	}
+	if cfg.packageName != "" {
+		args += " -package " + cfg.packageName
+	}
+	if cfg.cobra {
+		args += " -cobra"
+	}
+	if len(cfg.defaults) > 0 {
+		args += " -defaults " + strings.Join(cfg.defaults, ",")
+	}
+	if len(cfg.prefixes) > 0 {
+		args += " -prefix " + strings.Join(cfg.prefixes, ",")
+	}
+	return args
+}
+
+// defaultsNames lists the variables or functions holding the default values of the structs of cfg
+func defaultsNames(cfg *generatorConfig) string {
+	names := make([]string, len(cfg.structNames))
+	for i, structName := range cfg.structNames {
+		names[i] = "default" + strings.Title(structName)
+		if len(cfg.defaults) > 0 && cfg.defaults[i] != "" {
+			names[i] = cfg.defaults[i]
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
 func normalizeCode(code string) string {
 	// Normalize line endings
 	code = strings.ReplaceAll(code, "\r\n", "\n")
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// pflagsTag holds the options of a `pflags:"..."` struct tag.
+//
+// The tag is a comma-separated list of options, e.g.
+//
+//	pflags:"name=listen-port,short=p,usage='port to listen on, 0 for random',hidden,deprecated=use --addr,required"
+//
+// Values containing commas must be single-quoted. A lone "-" skips the field.
+type pflagsTag struct {
+	Skip       bool   // -
+	Name       string // name=<flag name>
+	Short      string // short=<letter>
+	Usage      string // usage=<text>
+	Hidden     bool   // hidden
+	Deprecated string // deprecated[=<message>]
+	Required   bool   // required
+	Array      bool   // array: StringArray instead of StringSlice for []string
+	Count      bool   // count: counter flag for int
+	Enum       bool   // enum: restrict to the constants of the field's type
+	Encoding   string // encoding=hex|base64 for []byte
+	Prefix     string // prefix=<flag name prefix> for embedded structs
+	Inline     bool   // inline: embedded struct fields without a prefix
+}
+
+// defaultDeprecationMessage is used for fields tagged with a bare `deprecated`
+const defaultDeprecationMessage = "it will be removed in a future release"
+
+// parseStructTag parses the pflags key of a raw struct tag literal, including its backquotes
+func parseStructTag(rawTag string) (pflagsTag, error) {
+	value, ok := reflect.StructTag(strings.Trim(rawTag, "`")).Lookup("pflags")
+	if !ok {
+		return pflagsTag{}, nil
+	}
+	return parsePflagsTag(value)
+}
+
+// parsePflagsTag parses the value of a pflags struct tag
+func parsePflagsTag(value string) (pflagsTag, error) {
+	var tag pflagsTag
+	if value == "-" {
+		tag.Skip = true
+		return tag, nil
+	}
+
+	options, err := splitTagOptions(value)
+	if err != nil {
+		return tag, err
+	}
+
+	for _, option := range options {
+		key, val, hasValue := strings.Cut(option, "=")
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'' {
+			val = val[1 : len(val)-1]
+		}
+
+		switch key {
+		case "":
+			continue
+		case "name":
+			tag.Name = val
+		case "short":
+			if len(val) != 1 {
+				return tag, fmt.Errorf("short must be a single character, got %q", val)
+			}
+			tag.Short = val
+		case "usage":
+			tag.Usage = val
+		case "hidden":
+			tag.Hidden = true
+		case "deprecated":
+			tag.Deprecated = val
+			if tag.Deprecated == "" {
+				tag.Deprecated = defaultDeprecationMessage
+			}
+		case "required":
+			tag.Required = true
+		case "array":
+			tag.Array = true
+		case "count":
+			tag.Count = true
+		case "enum":
+			tag.Enum = true
+		case "encoding":
+			if val != "hex" && val != "base64" {
+				return tag, fmt.Errorf("encoding must be hex or base64, got %q", val)
+			}
+			tag.Encoding = val
+		case "prefix":
+			tag.Prefix = val
+		case "inline":
+			tag.Inline = true
+		default:
+			return tag, fmt.Errorf("unknown pflags tag option %q", key)
+		}
+
+		if hasValue && val == "" && key != "deprecated" {
+			return tag, fmt.Errorf("empty value for pflags tag option %q", key)
+		}
+	}
+
+	if tag.Prefix != "" && tag.Inline {
+		return tag, fmt.Errorf("prefix and inline are mutually exclusive")
+	}
+
+	return tag, nil
+}
+
+// splitTagOptions splits a pflags tag value on commas outside single quotes
+func splitTagOptions(value string) ([]string, error) {
+	var options []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range value {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+		case r == ',' && !quoted:
+			options = append(options, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in pflags tag %q", value)
+	}
+	return append(options, current.String()), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParsePflagsTag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    pflagsTag
+		wantErr bool
+	}{
+		{value: "", want: pflagsTag{}},
+		{value: "-", want: pflagsTag{Skip: true}},
+		{value: "name=listen-port", want: pflagsTag{Name: "listen-port"}},
+		{value: "short=p", want: pflagsTag{Short: "p"}},
+		{value: "usage=port to listen on", want: pflagsTag{Usage: "port to listen on"}},
+		{value: "usage='port to listen on, 0 for random'", want: pflagsTag{Usage: "port to listen on, 0 for random"}},
+		{value: "hidden", want: pflagsTag{Hidden: true}},
+		{value: "deprecated", want: pflagsTag{Deprecated: defaultDeprecationMessage}},
+		{value: "deprecated=", want: pflagsTag{Deprecated: defaultDeprecationMessage}},
+		{value: "deprecated=use --addr", want: pflagsTag{Deprecated: "use --addr"}},
+		{value: "required", want: pflagsTag{Required: true}},
+		{value: "array", want: pflagsTag{Array: true}},
+		{value: "count", want: pflagsTag{Count: true}},
+		{value: "enum", want: pflagsTag{Enum: true}},
+		{value: "encoding=hex", want: pflagsTag{Encoding: "hex"}},
+		{value: "encoding=base64", want: pflagsTag{Encoding: "base64"}},
+		{value: "prefix=tls", want: pflagsTag{Prefix: "tls"}},
+		{value: "inline", want: pflagsTag{Inline: true}},
+		{
+			value: "name=listen-port,short=p,usage='port to listen on, 0 for random',hidden,deprecated=use --addr,required",
+			want: pflagsTag{
+				Name:       "listen-port",
+				Short:      "p",
+				Usage:      "port to listen on, 0 for random",
+				Hidden:     true,
+				Deprecated: "use --addr",
+				Required:   true,
+			},
+		},
+		{value: " name = port , required ", want: pflagsTag{Name: "port", Required: true}},
+		{value: "required,,hidden", want: pflagsTag{Required: true, Hidden: true}},
+
+		{value: "short=pp", wantErr: true},
+		{value: "short=", wantErr: true},
+		{value: "name=", wantErr: true},
+		{value: "usage=''", wantErr: true},
+		{value: "encoding=base32", wantErr: true},
+		{value: "prefix=tls,inline", wantErr: true},
+		{value: "usage='unterminated", wantErr: true},
+		{value: "unknown", wantErr: true},
+		{value: "-,required", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parsePflagsTag(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePflagsTag(%q) = %+v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePflagsTag(%q) failed: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parsePflagsTag(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStructTag(t *testing.T) {
+	tests := []struct {
+		rawTag string
+		want   pflagsTag
+	}{
+		{rawTag: "`json:\"port\"`", want: pflagsTag{}},
+		{rawTag: "`pflags:\"-\"`", want: pflagsTag{Skip: true}},
+		{rawTag: "`json:\"port\" pflags:\"short=p,required\"`", want: pflagsTag{Short: "p", Required: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rawTag, func(t *testing.T) {
+			got, err := parseStructTag(tt.rawTag)
+			if err != nil {
+				t.Fatalf("parseStructTag(%s) failed: %v", tt.rawTag, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseStructTag(%s) = %+v, want %+v", tt.rawTag, got, tt.want)
+			}
+		})
+	}
+}